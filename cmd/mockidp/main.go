@@ -0,0 +1,238 @@
+// Command mockidp is a minimal OpenID Connect provider for trying out and
+// testing sign-in locally. It signs in any username without a password, so
+// never expose it.
+//
+//	go run ./cmd/mockidp -issuer http://localhost:9000
+//
+// Point go-chat at it with OIDC_PROVIDERS=mock and OIDC_MOCK_ISSUER,
+// OIDC_MOCK_CLIENT_ID, OIDC_MOCK_CLIENT_SECRET and OIDC_MOCK_REDIRECT_URL
+// matching the flags. Add login_hint=<username> to the authorization URL to
+// skip the sign-in form.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bm-197/go-chat/internal/keys"
+)
+
+const (
+	keyID        = "mockidp"
+	codeTTL      = time.Minute
+	idTokenTTL   = 5 * time.Minute
+	emailDomain  = "example.com"
+	subjectScope = "mock|"
+)
+
+var signInPage = template.Must(template.New("signin").Parse(`<!DOCTYPE html>
+<title>Mock identity provider</title>
+<form method="post" action="/authorize">
+  {{range $name, $value := .}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+  {{end}}<label>Username <input name="login_hint" autofocus required></label>
+  <button>Sign in</button>
+</form>
+`))
+
+type grant struct {
+	username    string
+	nonce       string
+	challenge   string
+	redirectURI string
+	expiresAt   time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]*grant
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL")
+	clientID := flag.String("client-id", "go-chat", "client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "client secret; empty for a public client")
+	redirectURL := flag.String("redirect-url", "http://localhost:5000/api/auth/oidc/mock/callback", "allowed redirect URL")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		redirectURL:  *redirectURL,
+		key:          key,
+		codes:        make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+
+	log.Printf("Mock identity provider %s listening on %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, _ := keys.NewJWK(keyID, "RS256", &p.key.PublicKey)
+	writeJSON(w, http.StatusOK, keys.JWKSet{Keys: []keys.JWK{jwk}})
+}
+
+// authorize shows the sign-in form, or signs in login_hint right away.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := map[string]string{}
+	for _, name := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		params[name] = r.Form.Get(name)
+	}
+
+	// Errors about the client can't be sent back to it.
+	if params["client_id"] != p.clientID || params["redirect_uri"] != p.redirectURL {
+		http.Error(w, "unknown client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	redirect, _ := url.Parse(params["redirect_uri"])
+	query := redirect.Query()
+	query.Set("state", params["state"])
+
+	switch {
+	case params["response_type"] != "code":
+		query.Set("error", "unsupported_response_type")
+	case params["code_challenge"] == "" || params["code_challenge_method"] != "S256":
+		query.Set("error", "invalid_request")
+		query.Set("error_description", "PKCE with S256 is required")
+	case r.Form.Get("login_hint") == "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := signInPage.Execute(w, params); err != nil {
+			log.Printf("failed to render sign-in page: %v", err)
+		}
+		return
+	default:
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = &grant{
+			username:    r.Form.Get("login_hint"),
+			nonce:       params["nonce"],
+			challenge:   params["code_challenge"],
+			redirectURI: params["redirect_uri"],
+			expiresAt:   time.Now().Add(codeTTL),
+		}
+		p.mu.Unlock()
+		query.Set("code", code)
+	}
+
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for an ID token.
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                subjectScope + g.username,
+		"aud":                p.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(idTokenTTL).Unix(),
+		"nonce":              g.nonce,
+		"preferred_username": g.username,
+		"name":               g.username,
+		"email":              g.username + "@" + emailDomain,
+		"email_verified":     true,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
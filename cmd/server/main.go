@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/bm-197/go-chat/internal/api"
+	"github.com/bm-197/go-chat/internal/keys"
+	"github.com/bm-197/go-chat/internal/mail"
+	"github.com/bm-197/go-chat/internal/moderation"
+	"github.com/bm-197/go-chat/internal/oidc"
+	"github.com/bm-197/go-chat/internal/password"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/scheduler"
+	"github.com/bm-197/go-chat/internal/service"
 	"github.com/bm-197/go-chat/internal/store"
 )
 
@@ -25,19 +35,89 @@ func main() {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
+	keyRing, err := keys.NewRing(redisStore, keys.Config{
+		Algorithm:  envOr("JWT_ALGORITHM", keys.AlgHS256),
+		HMACSecret: os.Getenv("JWT_SECRET"),
+		Rotation:   envDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		Grace:      envDuration("JWT_KEY_GRACE", 24*time.Hour),
+	})
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	if err := keyRing.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	go keyRing.Run(context.Background())
+
+	oidcProviders, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid OIDC configuration: %v", err)
+	}
+
+	passwords, err := password.ManagerFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid password configuration: %v", err)
+	}
+
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+
+	// Custom plugins are registered here, e.g. plugins.Register(myPlugin{}, 10)
+	plugins := plugin.NewRegistry()
+
+	moderationEngine := moderation.NewEngine(redisStore)
+	go moderationEngine.Run(context.Background())
+	plugins.Register(moderationEngine, 0)
+
+	messageService := service.NewMessageService(redisStore, plugins)
+
+	// Deliver scheduled messages and purge expired ones from this node
+	dispatcher := scheduler.NewDispatcher(redisStore, messageService, time.Second)
+	go dispatcher.Run(context.Background())
+
+	sweeper := scheduler.NewSweeper(redisStore, 5*time.Second)
+	go sweeper.Run(context.Background())
+
 	e := echo.New()
+	// Rate limits key on the client IP, so don't trust X-Forwarded-For by
+	// default. Behind a reverse proxy, use echo.ExtractIPFromXFFHeader.
+	e.IPExtractor = echo.ExtractIPDirect()
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
-	// Register all routes
-	api.RegisterHandlers(e, redisStore)
-
-	// Start server
 	port := os.Getenv("APP_PORT")
 	if port == "" {
 		port = "5000"
 	}
+	// Links in emails point here
+	appURL := envOr("APP_URL", "http://localhost:"+port)
+
+	// Register all routes
+	api.RegisterHandlers(e, redisStore, messageService, plugins, keyRing, oidcProviders, passwords, mailer, appURL)
+
+	// Start server
 	e.Logger.Fatal(e.Start(":" + port))
 }
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return d
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/auth"
+	"github.com/bm-197/go-chat/internal/mail"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/password"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// mailTimeout bounds sending one email, which happens after the response.
+const mailTimeout = time.Minute
+
+// AccountHandler manages users' email addresses and password resets by
+// email.
+type AccountHandler struct {
+	store     *store.RedisStore
+	issuer    *auth.Issuer
+	passwords *password.Manager
+	mailer    mail.Mailer
+	appURL    string
+}
+
+func NewAccountHandler(store *store.RedisStore, issuer *auth.Issuer, passwords *password.Manager, mailer mail.Mailer, appURL string) *AccountHandler {
+	return &AccountHandler{
+		store:     store,
+		issuer:    issuer,
+		passwords: passwords,
+		mailer:    mailer,
+		appURL:    strings.TrimRight(appURL, "/"),
+	}
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password"` // Required if the account has one
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// ChangeEmail sets the caller's email address and sends a link to verify
+// it. Until then the address can't be used to reset the password. Setting
+// the same unverified address again resends the link.
+func (h *AccountHandler) ChangeEmail(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req ChangeEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if user.HasPassword() && !user.ValidatePassword(req.Password) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "password is incorrect")
+	}
+
+	if !strings.EqualFold(user.Email, req.Email) {
+		if user.EmailVerified {
+			if err := h.store.ReleaseEmail(ctx, user.ID, user.Email); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to change email")
+			}
+		}
+		if err := h.store.DeleteEmailToken(ctx, models.EmailTokenPasswordReset, user.ID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to change email")
+		}
+
+		replaced, err := h.store.ReplaceEmail(ctx, user.ID, user.Email, req.Email)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to change email")
+		}
+		if !replaced {
+			return echo.NewHTTPError(http.StatusConflict, "email was changed concurrently")
+		}
+		user.Email = req.Email
+		user.EmailVerified = false
+
+		event := newAuditEvent(c, models.AuditEmailChanged)
+		event.UserID = user.ID
+		event.Username = user.Username
+		recordAudit(c, h.store, event)
+	}
+
+	if !user.EmailVerified {
+		token, err := h.issuer.EmailToken(ctx, models.EmailTokenVerify, user.ID, user.Email)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to send verification email")
+		}
+		h.send(&mail.Message{
+			To:      user.Email,
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email address:\n\n%s\n\nThe link expires in %s.\n",
+				user.Username, h.link("/verify-email", token), auth.VerifyEmailTTL),
+		})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// VerifyEmail marks an email address verified with the token from the link
+// ChangeEmail sent. An address can be verified by one user at a time.
+func (h *AccountHandler) VerifyEmail(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req VerifyEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, token, err := h.redeem(ctx, models.EmailTokenVerify, req.Token)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	if err := h.store.ClaimEmail(ctx, user.ID, token.Email); err != nil {
+		if errors.Is(err, store.ErrEmailTaken) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify email")
+	}
+	verified, err := h.store.MarkEmailVerified(ctx, user.ID, token.Email)
+	if err == nil && !verified {
+		err = store.ErrEmailTokenInvalid
+	}
+	if err != nil {
+		// The address changed since the token was checked, or couldn't be
+		// marked verified, so it mustn't stay claimed.
+		if err := h.store.ReleaseEmail(ctx, user.ID, token.Email); err != nil {
+			log.Printf("failed to release email of user %s: %v", user.ID, err)
+		}
+		if errors.Is(err, store.ErrEmailTokenInvalid) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify email")
+	}
+
+	event := newAuditEvent(c, models.AuditEmailVerified)
+	event.UserID = user.ID
+	event.Username = user.Username
+	recordAudit(c, h.store, event)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RequestPasswordReset emails a password reset link to a verified address.
+// The response is the same whether or not the address belongs to anyone.
+func (h *AccountHandler) RequestPasswordReset(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req PasswordResetRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.store.GetUserByEmail(ctx, req.Email)
+	if err != nil || !user.EmailVerified || !strings.EqualFold(user.Email, req.Email) {
+		return c.NoContent(http.StatusAccepted)
+	}
+
+	token, err := h.issuer.EmailToken(ctx, models.EmailTokenPasswordReset, user.ID, user.Email)
+	if err != nil {
+		log.Printf("failed to create password reset token for user %s: %v", user.ID, err)
+		return c.NoContent(http.StatusAccepted)
+	}
+	h.send(&mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to choose a new password:\n\n%s\n\nThe link expires in %s. If you didn't ask to reset your password, ignore this email.\n",
+			user.Username, h.link("/reset-password", token), auth.PasswordResetTTL),
+	})
+
+	event := newAuditEvent(c, models.AuditPasswordResetSent)
+	event.UserID = user.ID
+	event.Username = user.Username
+	recordAudit(c, h.store, event)
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ConfirmPasswordReset sets a new password with the token from the link
+// RequestPasswordReset sent, and logs out every session. Two-factor
+// authentication still applies at the next login.
+func (h *AccountHandler) ConfirmPasswordReset(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req ConfirmPasswordResetRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, _, err := h.redeem(ctx, models.EmailTokenPasswordReset, req.Token)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return echo.NewHTTPError(http.StatusBadRequest, store.ErrEmailTokenInvalid.Error())
+	}
+	if err := h.passwords.Validate(req.NewPassword, user.Username); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	hash, err := h.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to reset password")
+	}
+	replaced, err := h.store.ReplacePassword(ctx, user.ID, user.Password, hash)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to reset password")
+	}
+	if !replaced {
+		return echo.NewHTTPError(http.StatusConflict, "password was changed concurrently")
+	}
+	if err := h.issuer.LogoutEverywhere(ctx, user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to log out sessions")
+	}
+
+	event := newAuditEvent(c, models.AuditPasswordReset)
+	event.UserID = user.ID
+	event.Username = user.Username
+	recordAudit(c, h.store, event)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// redeem uses up an emailed token and returns its user. Tokens for an
+// address the user has since changed are rejected.
+func (h *AccountHandler) redeem(ctx context.Context, purpose models.EmailTokenPurpose, token string) (*models.User, *models.EmailToken, error) {
+	emailToken, err := h.issuer.RedeemEmailToken(ctx, purpose, token)
+	if err != nil {
+		if errors.Is(err, store.ErrEmailTokenInvalid) {
+			return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to check token")
+	}
+
+	user, err := h.store.GetUserByID(ctx, emailToken.UserID)
+	if err != nil || user.Email != emailToken.Email {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, store.ErrEmailTokenInvalid.Error())
+	}
+	return user, emailToken, nil
+}
+
+// link builds a link to a page of the app that submits token to the API.
+func (h *AccountHandler) link(path, token string) string {
+	return h.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// send mails msg in the background, so responses don't wait on the mail
+// server or reveal whether a message was sent.
+func (h *AccountHandler) send(msg *mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			log.Printf("failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const maxAuditPageSize = 100
+
+type AuditHandler struct {
+	store *store.RedisStore
+}
+
+func NewAuditHandler(store *store.RedisStore) *AuditHandler {
+	return &AuditHandler{
+		store: store,
+	}
+}
+
+// ListAuditEvents returns audit events newest first, optionally for one
+// user with ?user_id=, paged with ?offset=&limit=.
+func (h *AuditHandler) ListAuditEvents(c echo.Context) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+	}
+	limit, err := queryInt(c, "limit", 50)
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+
+	events, err := h.store.GetAuditEvents(c.Request().Context(), c.QueryParam("user_id"), offset, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch audit events")
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func newAuditEvent(c echo.Context, eventType models.AuditEventType) *models.AuditEvent {
+	return models.NewAuditEvent(eventType, c.RealIP(), c.Request().UserAgent())
+}
+
+// recordAudit saves an audit event. Failing to does not fail the request.
+func recordAudit(c echo.Context, s *store.RedisStore, event *models.AuditEvent) {
+	if err := s.RecordAuditEvent(c.Request().Context(), event); err != nil {
+		log.Printf("failed to record %s audit event: %v", event.Type, err)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	maxBotsPerUser   = 10
+	maxAPIKeysPerBot = 10
+
+	// apiKeyPrefixLength is how much of a key is kept to tell keys apart.
+	apiKeyPrefixLength = len(middleware.APIKeyPrefix) + 6
+)
+
+type BotHandler struct {
+	store *store.RedisStore
+}
+
+func NewBotHandler(store *store.RedisStore) *BotHandler {
+	return &BotHandler{
+		store: store,
+	}
+}
+
+type CreateBotRequest struct {
+	Username string `json:"username" validate:"required,max=32"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string            `json:"name" validate:"required,max=64"`
+	Scopes []models.APIScope `json:"scopes" validate:"required,min=1"`
+}
+
+type SetBotPermissionsRequest struct {
+	CanBroadcast bool `json:"can_broadcast"`
+}
+
+// CreateAPIKeyResponse is the only time a key is shown; the server keeps
+// its hash.
+type CreateAPIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// CreateBot creates a bot owned by the caller. Bots can't log in; they use
+// API keys made by their owner.
+func (h *BotHandler) CreateBot(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req CreateBotRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	bots, err := h.store.GetUserBots(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch bots")
+	}
+	if len(bots) >= maxBotsPerUser {
+		return echo.NewHTTPError(http.StatusConflict, "bot limit reached")
+	}
+
+	bot := models.NewBot(req.Username, userID)
+	if err := h.store.SaveBot(ctx, bot); err != nil {
+		if err.Error() == "username already exists" {
+			return echo.NewHTTPError(http.StatusConflict, "username already exists")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create bot")
+	}
+
+	return c.JSON(http.StatusCreated, bot)
+}
+
+func (h *BotHandler) ListBots(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	bots, err := h.store.GetUserBots(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch bots")
+	}
+
+	return c.JSON(http.StatusOK, bots)
+}
+
+// DeleteBot revokes a bot's API keys, removes it from its groups and
+// deletes it. Its messages stay.
+func (h *BotHandler) DeleteBot(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	bot, err := h.ownedBot(c)
+	if err != nil {
+		return err
+	}
+
+	groups, err := h.store.GetUserGroups(ctx, bot.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch groups")
+	}
+	for _, group := range groups {
+		oldMembers := append([]string{}, group.Members...)
+		if !group.RemoveMember(bot.ID) {
+			continue
+		}
+		if err := h.store.SaveGroup(ctx, group); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to leave groups")
+		}
+		if err := h.store.UpdateGroupMembers(ctx, group, oldMembers); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to leave groups")
+		}
+	}
+
+	if err := h.store.DeleteBot(ctx, bot); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete bot")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateAPIKey makes an API key for one of the caller's bots, limited to
+// the requested scopes.
+func (h *BotHandler) CreateAPIKey(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid scope: "+string(scope))
+		}
+	}
+
+	bot, err := h.ownedBot(c)
+	if err != nil {
+		return err
+	}
+	keys, err := h.store.GetAPIKeys(ctx, bot.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch API keys")
+	}
+	if len(keys) >= maxAPIKeysPerBot {
+		return echo.NewHTTPError(http.StatusConflict, "API key limit reached")
+	}
+
+	key, keyHash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create API key")
+	}
+	apiKey := models.NewAPIKey(bot.ID, req.Name, key[:apiKeyPrefixLength], req.Scopes)
+	if err := h.store.SaveAPIKey(ctx, keyHash, apiKey); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create API key")
+	}
+
+	return c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func (h *BotHandler) ListAPIKeys(c echo.Context) error {
+	bot, err := h.ownedBot(c)
+	if err != nil {
+		return err
+	}
+
+	keys, err := h.store.GetAPIKeys(c.Request().Context(), bot.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch API keys")
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey deletes an API key and closes the WebSockets opened with it.
+func (h *BotHandler) RevokeAPIKey(c echo.Context) error {
+	bot, err := h.ownedBot(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.DeleteAPIKey(c.Request().Context(), bot.ID, c.Param("keyID")); err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke API key")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetBotPermissions lets admins allow a bot to broadcast.
+func (h *BotHandler) SetBotPermissions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req SetBotPermissionsRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	bot, err := h.store.GetUserByID(ctx, c.Param("id"))
+	if err != nil || !bot.IsBot {
+		return echo.NewHTTPError(http.StatusNotFound, "bot not found")
+	}
+
+	if err := h.store.SetCanBroadcast(ctx, bot.ID, req.CanBroadcast); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update bot")
+	}
+	bot.CanBroadcast = req.CanBroadcast
+
+	return c.JSON(http.StatusOK, bot)
+}
+
+// ownedBot returns the bot in the :id parameter if the caller owns it.
+func (h *BotHandler) ownedBot(c echo.Context) (*models.User, error) {
+	userID := c.Get("user_id").(string)
+	bot, err := h.store.GetUserByID(c.Request().Context(), c.Param("id"))
+	if err != nil || !bot.IsBot || bot.OwnerID != userID {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "bot not found")
+	}
+	return bot, nil
+}
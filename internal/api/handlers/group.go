@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -9,6 +11,11 @@ import (
 	"github.com/bm-197/go-chat/internal/store"
 )
 
+var (
+	errCannotRemoveCreator = errors.New("cannot remove group creator")
+	errUserNotMember       = errors.New("user is not a member of this group")
+)
+
 type GroupHandler struct {
 	store *store.RedisStore
 }
@@ -125,21 +132,32 @@ func (h *GroupHandler) RemoveMember(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "only group creator can remove members")
 	}
 
-	if memberID == group.CreatedBy {
-		return echo.NewHTTPError(http.StatusForbidden, "cannot remove group creator")
+	if err := removeGroupMember(c.Request().Context(), h.store, group, memberID); err != nil {
+		switch {
+		case errors.Is(err, errCannotRemoveCreator):
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case errors.Is(err, errUserNotMember):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove member from group")
 	}
 
+	return c.JSON(http.StatusOK, group)
+}
+
+// removeGroupMember removes memberID from group. It is shared by group
+// creators and moderators acting on reports.
+func removeGroupMember(ctx context.Context, s *store.RedisStore, group *models.Group, memberID string) error {
+	if memberID == group.CreatedBy {
+		return errCannotRemoveCreator
+	}
 	if !group.IsMember(memberID) {
-		return echo.NewHTTPError(http.StatusBadRequest, "user is not a member of this group")
+		return errUserNotMember
 	}
+
 	oldMembers := append([]string{}, group.Members...)
 	group.RemoveMember(memberID)
-
-	if err := h.store.UpdateGroupMembers(c.Request().Context(), group, oldMembers); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove member from group")
-	}
-
-	return c.JSON(http.StatusOK, group)
+	return s.UpdateGroupMembers(ctx, group, oldMembers)
 }
 
 func (h *GroupHandler) DeleteGroup(c echo.Context) error {
@@ -161,3 +179,29 @@ func (h *GroupHandler) DeleteGroup(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+func (h *GroupHandler) GetMessageTTL(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if !group.IsMember(userID) {
+		return echo.NewHTTPError(http.StatusForbidden, "not a member of this group")
+	}
+
+	return getMessageTTL(c, h.store, models.GroupConversationID(group.ID))
+}
+
+func (h *GroupHandler) SetMessageTTL(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if group.CreatedBy != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only group creator can change the message ttl")
+	}
+
+	return setMessageTTL(c, h.store, models.GroupConversationID(group.ID), userID)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/keys"
+)
+
+type KeysHandler struct {
+	keyRing *keys.Ring
+}
+
+func NewKeysHandler(keyRing *keys.Ring) *KeysHandler {
+	return &KeysHandler{
+		keyRing: keyRing,
+	}
+}
+
+// GetJWKS publishes the public keys that verify access tokens. New keys
+// appear an hour before they sign, so caching for a few minutes is safe.
+func (h *KeysHandler) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.keyRing.JWKS())
+}
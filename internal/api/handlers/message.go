@@ -1,29 +1,64 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
 	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/service"
 	"github.com/bm-197/go-chat/internal/store"
 )
 
+const (
+	maxWindowSize = 100
+
+	// maxIdempotencyKeyLength matches the limit on client_msg_id, which an
+	// Idempotency-Key header stands in for.
+	maxIdempotencyKeyLength = 128
+)
+
 type MessageHandler struct {
-	store *store.RedisStore
+	store   *store.RedisStore
+	service *service.MessageService
 }
 
-func NewMessageHandler(store *store.RedisStore) *MessageHandler {
+func NewMessageHandler(store *store.RedisStore, service *service.MessageService) *MessageHandler {
 	return &MessageHandler{
-		store: store,
+		store:   store,
+		service: service,
 	}
 }
 
 type SendMessageRequest struct {
 	Type    string `json:"type" validate:"required,oneof=private group broadcast"`
-	Content string `json:"content" validate:"required"`
+	Content string `json:"content"`
 	ToUser  string `json:"to_user,omitempty"`
 	ToGroup string `json:"to_group,omitempty"`
+	// ClientMsgID dedupes retries and is echoed back on the message.
+	ClientMsgID string `json:"client_msg_id,omitempty" validate:"max=128"`
+	// Attachments reference files already uploaded by the client.
+	Attachments []models.Attachment `json:"attachments,omitempty" validate:"max=10,dive"`
+	// SendAt schedules the message for later delivery when set.
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+type ForwardMessageRequest struct {
+	Type    string `json:"type" validate:"required,oneof=private group"`
+	ToUser  string `json:"to_user,omitempty"`
+	ToGroup string `json:"to_group,omitempty"`
+}
+
+type MessageTTLRequest struct {
+	TTLSeconds int64 `json:"ttl_seconds" validate:"gte=0,lte=31536000"` // 0 disables, max one year
+}
+
+type MessageTTLResponse struct {
+	TTLSeconds int64 `json:"ttl_seconds"`
 }
 
 func (h *MessageHandler) SendMessage(c echo.Context) error {
@@ -36,50 +71,166 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// The Idempotency-Key header takes precedence over client_msg_id.
+	idempotencyKey := c.Request().Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+	}
+
 	userID := c.Get("user_id").(string)
 	username := c.Get("username").(string)
-	msg := models.NewMessage(req.Type, req.Content, userID, username)
 
-	switch models.MessageType(req.Type) {
-	case models.MessageTypePrivate:
-		if req.ToUser == "" {
-			return echo.NewHTTPError(http.StatusBadRequest, "to_user is required for private messages")
-		}
-		_, err := h.store.GetUserByID(c.Request().Context(), req.ToUser)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusNotFound, "recipient not found")
-		}
-		msg.SetPrivateRecipient(req.ToUser)
+	if req.ClientMsgID == "" {
+		req.ClientMsgID = idempotencyKey
+	}
 
-	case models.MessageTypeGroup:
-		if req.ToGroup == "" {
-			return echo.NewHTTPError(http.StatusBadRequest, "to_group is required for group messages")
-		}
-		group, err := h.store.GetGroup(c.Request().Context(), req.ToGroup)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusNotFound, "group not found")
-		}
-		if !group.IsMember(userID) {
-			return echo.NewHTTPError(http.StatusForbidden, "not a member of this group")
-		}
-		msg.SetGroupRecipient(req.ToGroup)
+	result, err := h.service.Send(c.Request().Context(), userID, username, service.SendRequest{
+		Type:           models.MessageType(req.Type),
+		Content:        req.Content,
+		ToUserID:       req.ToUser,
+		GroupID:        req.ToGroup,
+		Attachments:    req.Attachments,
+		SendAt:         req.SendAt,
+		ClientMsgID:    req.ClientMsgID,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return serviceError(err, "failed to send message")
+	}
 
-	case models.MessageTypeBroadcast:
-		// No additional validation needed for broadcast
+	switch {
+	case result.Duplicate:
+		return c.JSON(http.StatusOK, result.Message)
+	case result.Scheduled:
+		return c.JSON(http.StatusAccepted, result.Message)
+	default:
+		return c.JSON(http.StatusCreated, result.Message)
 	}
+}
 
-	if err := h.store.SaveMessage(c.Request().Context(), msg); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save message")
+func (h *MessageHandler) ForwardMessage(c echo.Context) error {
+	var req ForwardMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	// Publish the message to Redis so that all websocket nodes can forward it to
-	// connected clients. I intentionally ignored publish errors for now because
-	// the message has already been persisted; the sender can retry fetch if needed.
-	_ = h.store.PublishMessage(c.Request().Context(), msg)
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	userID := c.Get("user_id").(string)
+	username := c.Get("username").(string)
+
+	msg, err := h.service.Forward(c.Request().Context(), userID, username, service.ForwardRequest{
+		MessageID: c.Param("id"),
+		Type:      models.MessageType(req.Type),
+		ToUserID:  req.ToUser,
+		GroupID:   req.ToGroup,
+	})
+	if err != nil {
+		return serviceError(err, "failed to forward message")
+	}
 
 	return c.JSON(http.StatusCreated, msg)
 }
 
+// serviceError converts an error from the service layer into an HTTP error,
+// hiding internal failures behind fallback.
+func serviceError(err error, fallback string) error {
+	var serviceErr *service.Error
+	if !errors.As(err, &serviceErr) {
+		log.Printf("%s: %v", fallback, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+	}
+
+	switch serviceErr.Kind {
+	case service.KindNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, serviceErr.Message)
+	case service.KindForbidden:
+		return echo.NewHTTPError(http.StatusForbidden, serviceErr.Message)
+	case service.KindConflict:
+		return echo.NewHTTPError(http.StatusConflict, serviceErr.Message)
+	case service.KindRejected:
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, serviceErr.Message)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, serviceErr.Message)
+	}
+}
+
+func (h *MessageHandler) GetScheduledMessages(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	messages, err := h.store.GetScheduledMessages(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get scheduled messages")
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+func (h *MessageHandler) CancelScheduledMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	messageID := c.Param("id")
+
+	if err := h.store.CancelScheduledMessage(c.Request().Context(), userID, messageID); err != nil {
+		if errors.Is(err, store.ErrScheduledMessageNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "scheduled message not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to cancel scheduled message")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *MessageHandler) GetPrivateMessageTTL(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	return getMessageTTL(c, h.store, models.PrivateConversationID(userID, c.Param("userID")))
+}
+
+func (h *MessageHandler) SetPrivateMessageTTL(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	if _, err := h.store.GetUserByID(c.Request().Context(), c.Param("userID")); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	return setMessageTTL(c, h.store, models.PrivateConversationID(userID, c.Param("userID")), userID)
+}
+
+func getMessageTTL(c echo.Context, s *store.RedisStore, conversationID string) error {
+	ttl, err := s.GetConversationTTL(c.Request().Context(), conversationID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get message ttl")
+	}
+
+	return c.JSON(http.StatusOK, MessageTTLResponse{TTLSeconds: int64(ttl.Seconds())})
+}
+
+// setMessageTTL changes the disappearing-message timer of a conversation.
+// It only affects messages sent afterwards.
+func setMessageTTL(c echo.Context, s *store.RedisStore, conversationID, userID string) error {
+	var req MessageTTLRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if err := s.SetConversationTTL(c.Request().Context(), conversationID, ttl); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to set message ttl")
+	}
+
+	resp := MessageTTLResponse{TTLSeconds: req.TTLSeconds}
+	event := models.NewEvent(models.EventMessageTTLSet, conversationID, userID)
+	event.Data = resp
+	if err := s.PublishEvent(c.Request().Context(), event); err != nil {
+		log.Printf("failed to publish message ttl event: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
 func (h *MessageHandler) GetPrivateMessages(c echo.Context) error {
 	userID := c.Get("user_id").(string)
 	otherUserID := c.Param("userID")
@@ -111,6 +262,8 @@ func (h *MessageHandler) GetGroupMessages(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get messages")
 	}
 
+	h.attachPollResults(c.Request().Context(), messages, userID)
+
 	return c.JSON(http.StatusOK, messages)
 }
 
@@ -124,3 +277,104 @@ func (h *MessageHandler) GetBroadcastMessages(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, messages)
 }
+
+func (h *MessageHandler) GetPrivateMessagesAround(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	otherUserID := c.Param("userID")
+
+	anchor, before, after, err := parseAnchor(c)
+	if err != nil {
+		return err
+	}
+
+	window, err := h.store.GetPrivateMessagesAround(c.Request().Context(), userID, otherUserID, anchor, before, after)
+	return respondWindow(c, window, err)
+}
+
+func (h *MessageHandler) GetGroupMessagesAround(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	groupID := c.Param("groupID")
+
+	anchor, before, after, err := parseAnchor(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.store.GetGroup(c.Request().Context(), groupID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if !group.IsMember(userID) {
+		return echo.NewHTTPError(http.StatusForbidden, "not a member of this group")
+	}
+
+	window, err := h.store.GetGroupMessagesAround(c.Request().Context(), groupID, anchor, before, after)
+	if err == nil {
+		h.attachPollResults(c.Request().Context(), window.Messages, userID)
+	}
+	return respondWindow(c, window, err)
+}
+
+func (h *MessageHandler) GetBroadcastMessagesAround(c echo.Context) error {
+	anchor, before, after, err := parseAnchor(c)
+	if err != nil {
+		return err
+	}
+
+	window, err := h.store.GetBroadcastMessagesAround(c.Request().Context(), anchor, before, after)
+	return respondWindow(c, window, err)
+}
+
+// parseAnchor reads ?message_id= or ?at= (RFC 3339) plus the optional
+// ?before= and ?after= window sizes.
+func parseAnchor(c echo.Context) (store.MessageAnchor, int64, int64, error) {
+	var anchor store.MessageAnchor
+	anchor.MessageID = c.QueryParam("message_id")
+
+	at, err := queryTime(c, "at")
+	if err != nil {
+		return anchor, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid at")
+	}
+	anchor.At = at
+	if anchor.MessageID == "" && anchor.At.IsZero() {
+		return anchor, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "message_id or at is required")
+	}
+
+	before, err := queryInt(c, "before", 25)
+	if err != nil || before < 0 || before > maxWindowSize {
+		return anchor, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid before")
+	}
+	after, err := queryInt(c, "after", 25)
+	if err != nil || after < 0 || after > maxWindowSize {
+		return anchor, 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid after")
+	}
+
+	return anchor, before, after, nil
+}
+
+func respondWindow(c echo.Context, window *store.MessageWindow, err error) error {
+	if err != nil {
+		if errors.Is(err, store.ErrMessageNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "message not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get messages")
+	}
+
+	return c.JSON(http.StatusOK, window)
+}
+
+// attachPollResults fills in current tallies and userID's vote for every poll
+// in messages.
+func (h *MessageHandler) attachPollResults(ctx context.Context, messages []*models.Message, userID string) {
+	for _, msg := range messages {
+		if msg.Poll == nil {
+			continue
+		}
+		results, err := h.store.GetPollResults(ctx, msg, userID)
+		if err != nil {
+			log.Printf("failed to get results of poll %s: %v", msg.ID, err)
+			continue
+		}
+		msg.Poll.Results = results
+	}
+}
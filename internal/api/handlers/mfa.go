@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/auth"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// totpIssuer names the account in authenticator apps.
+const totpIssuer = "go-chat"
+
+type MFAHandler struct {
+	store *store.RedisStore
+	guard *auth.LoginGuard
+}
+
+func NewMFAHandler(store *store.RedisStore, guard *auth.LoginGuard) *MFAHandler {
+	return &MFAHandler{
+		store: store,
+		guard: guard,
+	}
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFAStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *MFAHandler) GetStatus(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	config, err := h.store.GetTOTP(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch two-factor authentication")
+	}
+
+	var status MFAStatusResponse
+	if config != nil && config.Enabled {
+		status.Enabled = true
+		if status.RecoveryCodesLeft, err = h.store.CountRecoveryCodes(ctx, userID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch two-factor authentication")
+		}
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP creates a new authenticator secret for the caller. It takes
+// effect once confirmed with a code; enrolling again before that replaces
+// the secret.
+func (h *MFAHandler) EnrollTOTP(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	config, err := h.store.GetTOTP(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch two-factor authentication")
+	}
+	if config != nil && config.Enabled {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate secret")
+	}
+
+	config = &models.TOTPConfig{
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.SaveTOTP(ctx, userID, config, nil); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save two-factor authentication")
+	}
+
+	return c.JSON(http.StatusCreated, TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the caller proves
+// their authenticator works, and returns recovery codes. They are only
+// shown this once.
+func (h *MFAHandler) ConfirmTOTP(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req MFACodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	config, err := h.store.GetTOTP(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch two-factor authentication")
+	}
+	if config == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no pending enrollment")
+	}
+	if config.Enabled {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	step, ok := auth.ValidateTOTP(config.Secret, req.Code, time.Now())
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidCode.Error())
+	}
+	fresh, err := h.store.UseTOTPStep(ctx, userID, step, auth.TOTPReplayWindow)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to enable two-factor authentication")
+	}
+	if !fresh {
+		return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidCode.Error())
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate recovery codes")
+	}
+	now := time.Now()
+	config.Enabled = true
+	config.EnabledAt = &now
+	if err := h.store.SaveTOTP(ctx, userID, config, hashes); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to enable two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off. It takes a current TOTP
+// or recovery code, so a stolen access token alone can't do it.
+func (h *MFAHandler) DisableTOTP(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	if err := h.verifyCode(c, userID); err != nil {
+		return err
+	}
+	if err := h.store.DeleteTOTP(ctx, userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to disable two-factor authentication")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes. It takes a
+// current TOTP or recovery code.
+func (h *MFAHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	if err := h.verifyCode(c, userID); err != nil {
+		return err
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate recovery codes")
+	}
+	if err := h.store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save recovery codes")
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *MFAHandler) verifyCode(c echo.Context, userID string) error {
+	var req MFACodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Codes checked here count towards the same lockout as logins, so a
+	// stolen access token can't be used to guess them either.
+	user, err := h.store.GetUserByID(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if err := checkLockout(c, h.store, h.guard, user.Username); err != nil {
+		return err
+	}
+
+	if err := auth.VerifySecondFactor(c.Request().Context(), h.store, userID, req.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			secondFactorFailed(c, h.store, h.guard, user, err)
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify code")
+	}
+	return nil
+}
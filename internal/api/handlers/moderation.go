@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/moderation"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const maxFlagsPageSize = 100
+
+type ModerationHandler struct {
+	store *store.RedisStore
+}
+
+func NewModerationHandler(store *store.RedisStore) *ModerationHandler {
+	return &ModerationHandler{
+		store: store,
+	}
+}
+
+func (h *ModerationHandler) GetGlobalRules(c echo.Context) error {
+	return h.getRules(c, models.GlobalModerationScope)
+}
+
+func (h *ModerationHandler) SetGlobalRules(c echo.Context) error {
+	return h.setRules(c, models.GlobalModerationScope)
+}
+
+func (h *ModerationHandler) GetGroupRules(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if group.CreatedBy != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only group creator can view moderation rules")
+	}
+
+	return h.getRules(c, models.GroupConversationID(group.ID))
+}
+
+func (h *ModerationHandler) SetGroupRules(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if group.CreatedBy != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only group creator can change moderation rules")
+	}
+
+	return h.setRules(c, models.GroupConversationID(group.ID))
+}
+
+// ListFlags returns messages flagged by moderation rules, newest first,
+// paged with ?offset=&limit=.
+func (h *ModerationHandler) ListFlags(c echo.Context) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+	}
+	limit, err := queryInt(c, "limit", 50)
+	if err != nil || limit < 1 || limit > maxFlagsPageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+
+	flags, err := h.store.GetModerationFlags(c.Request().Context(), offset, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch flagged messages")
+	}
+
+	return c.JSON(http.StatusOK, flags)
+}
+
+func (h *ModerationHandler) getRules(c echo.Context, scope string) error {
+	rules, err := h.store.GetModerationRules(c.Request().Context(), scope)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch moderation rules")
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (h *ModerationHandler) setRules(c echo.Context, scope string) error {
+	var rules models.ModerationRules
+	if err := c.Bind(&rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if rules.Rules == nil {
+		rules.Rules = []models.ModerationRule{}
+	}
+	if err := moderation.Validate(&rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	rules.UpdatedBy = c.Get("user_id").(string)
+	rules.UpdatedAt = time.Now()
+	if err := h.store.SaveModerationRules(c.Request().Context(), scope, &rules); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save moderation rules")
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
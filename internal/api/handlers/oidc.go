@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/auth"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/oidc"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	// oidcLoginTTL is how long a user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+
+	// oidcStateCookie holds the state of the sign-in started in a browser,
+	// so a callback for a sign-in started elsewhere, such as a link URL an
+	// attacker sent, is refused.
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/auth/oidc/"
+
+	maxUsernameLength = 32
+)
+
+type OIDCHandler struct {
+	store     *store.RedisStore
+	issuer    *auth.Issuer
+	providers *oidc.Providers
+}
+
+func NewOIDCHandler(store *store.RedisStore, issuer *auth.Issuer, providers *oidc.Providers) *OIDCHandler {
+	return &OIDCHandler{
+		store:     store,
+		issuer:    issuer,
+		providers: providers,
+	}
+}
+
+type ProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type AuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// ListProviders lists the identity providers users can sign in with.
+func (h *OIDCHandler) ListProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, ProvidersResponse{Providers: h.providers.Names()})
+}
+
+// Login redirects to the provider's sign-in page. The provider sends the
+// user back to Callback.
+func (h *OIDCHandler) Login(c echo.Context) error {
+	authURL, err := h.start(c, "")
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Link starts linking a provider account to the caller. The client sends
+// the user to the returned URL; the link is made in Callback.
+func (h *OIDCHandler) Link(c echo.Context) error {
+	authURL, err := h.start(c, c.Get("user_id").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, AuthorizationResponse{AuthorizationURL: authURL})
+}
+
+// Callback completes a sign-in at the provider. Sign-ins return a token pair
+// or a second-factor challenge like Login; links return the new identity.
+func (h *OIDCHandler) Callback(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if errCode := c.QueryParam("error"); errCode != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "sign-in failed: "+errCode)
+	}
+	state, code := c.QueryParam("state"), c.QueryParam("code")
+	if state == "" || code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing state or code")
+	}
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "sign-in was not started in this browser")
+	}
+	setStateCookie(c, "", -1)
+
+	login, err := h.store.TakeOIDCLogin(ctx, state)
+	if err != nil {
+		if errors.Is(err, store.ErrOIDCLoginNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch sign-in")
+	}
+	if login.Provider != provider.Name() {
+		return echo.NewHTTPError(http.StatusBadRequest, store.ErrOIDCLoginNotFound.Error())
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("sign-in with %s failed: %v", provider.Name(), err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "sign-in failed")
+	}
+
+	if login.LinkUserID != "" {
+		identity, err := h.link(ctx, login.LinkUserID, claims)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, identity)
+	}
+
+	user, err := h.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to sign in")
+	}
+
+	suspension, err := h.store.GetSuspension(ctx, user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check account status")
+	}
+	if suspension != nil {
+		return echo.NewHTTPError(http.StatusForbidden, "account suspended")
+	}
+
+	challenge, err := challengeMFA(c, h.store, h.issuer, user)
+	if err != nil {
+		return err
+	}
+	if challenge != nil {
+		return c.JSON(http.StatusOK, challenge)
+	}
+
+	tokens, err := h.issuer.Issue(ctx, user, newDevice(c, ""))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate token")
+	}
+	event := newAuditEvent(c, models.AuditLoginSucceeded)
+	event.UserID = user.ID
+	event.Username = user.Username
+	event.Detail = "signed in with " + provider.Name()
+	recordAudit(c, h.store, event)
+
+	return c.JSON(http.StatusOK, newAuthResponse(tokens))
+}
+
+func (h *OIDCHandler) ListIdentities(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	identities, err := h.store.GetUserIdentities(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch identities")
+	}
+
+	return c.JSON(http.StatusOK, identities)
+}
+
+// Unlink removes the caller's link to a provider. The last way to sign in
+// can't be removed.
+func (h *OIDCHandler) Unlink(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if !user.HasPassword() {
+		identities, err := h.store.GetUserIdentities(ctx, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch identities")
+		}
+		if len(identities) <= 1 {
+			return echo.NewHTTPError(http.StatusConflict, "cannot unlink the only way to sign in")
+		}
+	}
+
+	if err := h.store.UnlinkIdentity(ctx, userID, c.Param("provider")); err != nil {
+		if errors.Is(err, store.ErrIdentityNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unlink identity")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// start saves a new sign-in and returns the provider URL for it.
+func (h *OIDCHandler) start(c echo.Context, linkUserID string) (string, error) {
+	ctx := c.Request().Context()
+
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = oidc.RandomString(); err != nil {
+			return "", echo.NewHTTPError(http.StatusInternalServerError, "failed to start sign-in")
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("failed to start sign-in with %s: %v", provider.Name(), err)
+		return "", echo.NewHTTPError(http.StatusBadGateway, "identity provider unavailable")
+	}
+
+	login := &models.OIDCLogin{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		CreatedAt:    time.Now(),
+	}
+	if err := h.store.SaveOIDCLogin(ctx, state, login, oidcLoginTTL); err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "failed to start sign-in")
+	}
+	setStateCookie(c, state, int(oidcLoginTTL.Seconds()))
+	return authURL, nil
+}
+
+// setStateCookie sets the sign-in state cookie, or clears it if maxAge is
+// negative.
+func setStateCookie(c echo.Context, state string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		// Lax still sends it on the provider's redirect back.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// link links the provider account to userID. A user has at most one account
+// per provider.
+func (h *OIDCHandler) link(ctx context.Context, userID string, claims *oidc.Claims) (*models.Identity, error) {
+	identities, err := h.store.GetUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch identities")
+	}
+	for _, identity := range identities {
+		if identity.Provider == claims.Provider && identity.Subject != claims.Subject {
+			return nil, echo.NewHTTPError(http.StatusConflict, "another account at this provider is already linked")
+		}
+	}
+
+	identity := newIdentity(userID, claims)
+	if err := h.store.LinkIdentity(ctx, identity); err != nil {
+		if errors.Is(err, store.ErrIdentityLinked) {
+			return nil, echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to link identity")
+	}
+	return identity, nil
+}
+
+// resolveUser returns the user a provider account signs in as: the linked
+// user, the user with the same username on providers trusted for it, or a
+// new user.
+func (h *OIDCHandler) resolveUser(ctx context.Context, provider *oidc.Provider, claims *oidc.Claims) (*models.User, error) {
+	identity, err := h.store.GetIdentity(ctx, claims.Provider, claims.Subject)
+	if err == nil {
+		return h.store.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, store.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if provider.LinkByUsername() && claims.PreferredUsername != "" {
+		if user, err := h.store.GetUserByUsername(ctx, claims.PreferredUsername); err == nil && !user.IsBot {
+			if err := h.store.LinkIdentity(ctx, newIdentity(user.ID, claims)); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+	}
+
+	user, err := h.createUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.store.LinkIdentity(ctx, newIdentity(user.ID, claims)); err != nil {
+		if err := h.store.DeleteUser(ctx, user); err != nil {
+			log.Printf("failed to delete user %s: %v", user.ID, err)
+		}
+		if !errors.Is(err, store.ErrIdentityLinked) {
+			return nil, err
+		}
+		// A concurrent first sign-in won.
+		identity, err := h.store.GetIdentity(ctx, claims.Provider, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return h.store.GetUserByID(ctx, identity.UserID)
+	}
+	return user, nil
+}
+
+// createUser creates a user for a provider account, named after it. A taken
+// name gets a random suffix.
+func (h *OIDCHandler) createUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	base := usernameFromClaims(claims)
+	username := base
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		user := models.NewExternalUser(username)
+		if err = h.store.SaveUser(ctx, user); err == nil {
+			return user, nil
+		}
+		if err.Error() != "username already exists" {
+			return nil, err
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+	return nil, err
+}
+
+func newIdentity(userID string, claims *oidc.Claims) *models.Identity {
+	identity := &models.Identity{
+		Provider: claims.Provider,
+		Subject:  claims.Subject,
+		UserID:   userID,
+		LinkedAt: time.Now(),
+	}
+	if claims.EmailVerified {
+		identity.Email = claims.Email
+	}
+	return identity
+}
+
+// usernameFromClaims picks a username from the provider's preferred
+// username, the email's local part or the display name.
+func usernameFromClaims(claims *oidc.Claims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, candidate := range []string{claims.PreferredUsername, local, claims.Name} {
+		username := strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '_', r == '-':
+				return r
+			case unicode.IsSpace(r):
+				return '_'
+			}
+			return -1
+		}, strings.TrimSpace(candidate))
+		if runes := []rune(username); len(runes) > maxUsernameLength {
+			username = string(runes[:maxUsernameLength])
+		}
+		if username != "" {
+			return username
+		}
+	}
+	return claims.Provider + "-user"
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+type PinHandler struct {
+	store *store.RedisStore
+}
+
+func NewPinHandler(store *store.RedisStore) *PinHandler {
+	return &PinHandler{
+		store: store,
+	}
+}
+
+func (h *PinHandler) PinGroupMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if group.CreatedBy != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only group creator can pin messages")
+	}
+
+	return h.pin(c, models.GroupConversationID(group.ID), userID)
+}
+
+func (h *PinHandler) UnpinGroupMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if group.CreatedBy != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only group creator can unpin messages")
+	}
+
+	return h.unpin(c, models.GroupConversationID(group.ID), userID)
+}
+
+func (h *PinHandler) GetGroupPins(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	group, err := h.store.GetGroup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if !group.IsMember(userID) {
+		return echo.NewHTTPError(http.StatusForbidden, "not a member of this group")
+	}
+
+	return h.list(c, models.GroupConversationID(group.ID))
+}
+
+func (h *PinHandler) PinPrivateMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	return h.pin(c, models.PrivateConversationID(userID, c.Param("userID")), userID)
+}
+
+func (h *PinHandler) UnpinPrivateMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	return h.unpin(c, models.PrivateConversationID(userID, c.Param("userID")), userID)
+}
+
+func (h *PinHandler) GetPrivatePins(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	return h.list(c, models.PrivateConversationID(userID, c.Param("userID")))
+}
+
+func (h *PinHandler) pin(c echo.Context, conversationID, userID string) error {
+	ctx := c.Request().Context()
+
+	msg, err := h.store.GetMessage(ctx, c.Param("messageID"))
+	if err != nil || msg.ConversationID() != conversationID {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
+
+	pin := models.NewPin(msg.ID, userID)
+	if err := h.store.PinMessage(ctx, conversationID, pin, models.MaxPinsPerConversation); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlreadyPinned):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrPinLimitReached):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to pin message")
+	}
+	pin.Message = msg
+
+	event := models.NewEvent(models.EventMessagePinned, conversationID, userID)
+	event.MessageID = msg.ID
+	event.Data = pin
+	if err := h.store.PublishEvent(ctx, event); err != nil {
+		log.Printf("failed to publish pin event: %v", err)
+	}
+
+	return c.JSON(http.StatusCreated, pin)
+}
+
+func (h *PinHandler) unpin(c echo.Context, conversationID, userID string) error {
+	ctx := c.Request().Context()
+	messageID := c.Param("messageID")
+
+	if err := h.store.UnpinMessage(ctx, conversationID, messageID); err != nil {
+		if errors.Is(err, store.ErrNotPinned) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unpin message")
+	}
+
+	event := models.NewEvent(models.EventMessageUnpinned, conversationID, userID)
+	event.MessageID = messageID
+	if err := h.store.PublishEvent(ctx, event); err != nil {
+		log.Printf("failed to publish unpin event: %v", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *PinHandler) list(c echo.Context, conversationID string) error {
+	pins, err := h.store.GetPins(c.Request().Context(), conversationID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get pins")
+	}
+
+	return c.JSON(http.StatusOK, pins)
+}
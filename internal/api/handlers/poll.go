@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/service"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+var errNotGroupMember = errors.New("not a member of this group")
+
+type PollHandler struct {
+	store   *store.RedisStore
+	service *service.MessageService
+}
+
+func NewPollHandler(store *store.RedisStore, service *service.MessageService) *PollHandler {
+	return &PollHandler{
+		store:   store,
+		service: service,
+	}
+}
+
+type CreatePollRequest struct {
+	Question       string     `json:"question" validate:"required"`
+	Options        []string   `json:"options" validate:"min=2,max=10,dive,required"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+type VoteRequest struct {
+	Options []int `json:"options" validate:"required,min=1"`
+}
+
+func (h *PollHandler) CreatePoll(c echo.Context) error {
+	var req CreatePollRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	userID := c.Get("user_id").(string)
+	username := c.Get("username").(string)
+
+	result, err := h.service.Send(c.Request().Context(), userID, username, service.SendRequest{
+		Type:    models.MessageTypeGroup,
+		Content: req.Question,
+		GroupID: c.Param("id"),
+		Poll: &models.Poll{
+			Options:        req.Options,
+			MultipleChoice: req.MultipleChoice,
+			Anonymous:      req.Anonymous,
+			ClosesAt:       req.ClosesAt,
+		},
+	})
+	if err != nil {
+		return serviceError(err, "failed to create poll")
+	}
+
+	return c.JSON(http.StatusCreated, result.Message)
+}
+
+func (h *PollHandler) Vote(c echo.Context) error {
+	var req VoteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	userID := c.Get("user_id").(string)
+	results, err := castVote(c.Request().Context(), h.store, userID, c.Param("messageID"), req.Options)
+	if err != nil {
+		return voteError(err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// voteError maps an error from castVote to the HTTP error reported to the
+// voter.
+func voteError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrMessageNotFound), errors.Is(err, models.ErrNotAPoll):
+		return echo.NewHTTPError(http.StatusNotFound, "poll not found")
+	case errors.Is(err, errNotGroupMember):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, models.ErrPollClosed):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrInvalidVote), errors.Is(err, models.ErrSingleChoice), errors.Is(err, models.ErrEmptyPollVote):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	log.Printf("failed to record vote: %v", err)
+	return echo.NewHTTPError(http.StatusInternalServerError, "failed to record vote")
+}
+
+// castVote records a vote on a group poll and pushes the new tallies to the
+// group. It is shared by the REST endpoint and the WebSocket poll_vote op.
+func castVote(ctx context.Context, s *store.RedisStore, userID, messageID string, options []int) (*models.PollResults, error) {
+	msg, err := s.GetMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Poll == nil || msg.Type != models.MessageTypeGroup {
+		return nil, models.ErrNotAPoll
+	}
+
+	group, err := s.GetGroup(ctx, msg.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	if !group.IsMember(userID) {
+		return nil, errNotGroupMember
+	}
+
+	if msg.Poll.IsClosed(time.Now()) {
+		return nil, models.ErrPollClosed
+	}
+
+	vote, err := msg.Poll.NormalizeVote(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.VotePoll(ctx, msg.ID, userID, vote); err != nil {
+		return nil, err
+	}
+
+	results, err := s.GetPollResults(ctx, msg, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everyone in the group gets the tallies, but not the voter's own choice.
+	public := *results
+	public.MyVote = nil
+	actorID := userID
+	if msg.Poll.Anonymous {
+		actorID = ""
+	}
+	event := models.NewEvent(models.EventPollUpdated, msg.ConversationID(), actorID)
+	event.MessageID = msg.ID
+	event.Data = &public
+	if err := s.PublishEvent(ctx, event); err != nil {
+		log.Printf("failed to publish poll update: %v", err)
+	}
+
+	return results, nil
+}
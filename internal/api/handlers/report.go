@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/service"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	maxReportsPageSize = 100
+
+	// reportContextSize is how many messages are shown on each side of a
+	// reported message.
+	reportContextSize = 10
+
+	// maxSuspendSeconds caps timed suspensions at ten years; longer ones
+	// should be indefinite.
+	maxSuspendSeconds = 10 * 365 * 24 * 60 * 60
+)
+
+type ReportHandler struct {
+	store *store.RedisStore
+}
+
+func NewReportHandler(store *store.RedisStore) *ReportHandler {
+	return &ReportHandler{
+		store: store,
+	}
+}
+
+type CreateReportRequest struct {
+	MessageID string `json:"message_id" validate:"required_without=UserID"`
+	UserID    string `json:"user_id" validate:"required_without=MessageID"`
+	Reason    string `json:"reason" validate:"required,oneof=spam harassment hate violence sexual_content other"`
+	Details   string `json:"details" validate:"max=1000"`
+}
+
+type ResolveReportRequest struct {
+	Action         models.ReportAction `json:"action" validate:"required,oneof=dismiss delete_message remove_member suspend_user"`
+	Note           string              `json:"note" validate:"max=1000"`
+	SuspendSeconds int                 `json:"suspend_seconds" validate:"min=0"` // 0 suspends indefinitely
+}
+
+// ReportDetail is a report with the conversation around the reported
+// message, when it still exists.
+type ReportDetail struct {
+	*models.Report
+	Context *store.MessageWindow `json:"context,omitempty"`
+}
+
+// CreateReport reports a message the caller can read, or a user. Reporting
+// the same target again while the first report is open returns it.
+func (h *ReportHandler) CreateReport(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req CreateReportRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report := models.NewReport(userID, req.Reason, req.Details)
+	if req.MessageID != "" {
+		msg, err := h.store.GetMessage(ctx, req.MessageID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "message not found")
+		}
+		canRead, err := service.CanReadMessage(ctx, h.store, userID, msg)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check message access")
+		}
+		if !canRead {
+			return echo.NewHTTPError(http.StatusNotFound, "message not found")
+		}
+		report.SetMessage(msg)
+	} else {
+		if _, err := h.store.GetUserByID(ctx, req.UserID); err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		report.UserID = req.UserID
+	}
+	if report.UserID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot report yourself")
+	}
+
+	report, created, err := h.store.CreateReport(ctx, report)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create report")
+	}
+	if !created {
+		return c.JSON(http.StatusOK, report)
+	}
+
+	return c.JSON(http.StatusCreated, report)
+}
+
+// ListReports returns the moderation queue, filtered by ?status= (default
+// open) and paged with ?offset=&limit=.
+func (h *ReportHandler) ListReports(c echo.Context) error {
+	status := models.ReportStatus(c.QueryParam("status"))
+	if status == "" {
+		status = models.ReportOpen
+	}
+	if !status.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+	}
+	limit, err := queryInt(c, "limit", 50)
+	if err != nil || limit < 1 || limit > maxReportsPageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+
+	reports, err := h.store.GetReports(c.Request().Context(), status, offset, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch reports")
+	}
+
+	return c.JSON(http.StatusOK, reports)
+}
+
+func (h *ReportHandler) GetReport(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	report, err := h.store.GetReport(ctx, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrReportNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch report")
+	}
+
+	detail := &ReportDetail{Report: report}
+	if report.Message != nil {
+		detail.Context, err = h.messageContext(ctx, report.Message)
+		if err != nil && !errors.Is(err, store.ErrMessageNotFound) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch message context")
+		}
+	}
+
+	return c.JSON(http.StatusOK, detail)
+}
+
+// ResolveReport closes an open report and carries out the chosen action.
+func (h *ReportHandler) ResolveReport(c echo.Context) error {
+	moderatorID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req ResolveReportRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report, err := h.store.GetReport(ctx, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrReportNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch report")
+	}
+	if report.Status != models.ReportOpen {
+		return echo.NewHTTPError(http.StatusConflict, store.ErrReportResolved.Error())
+	}
+	if err := checkReportAction(report, &req); err != nil {
+		return err
+	}
+
+	// Resolving the report is the claim, so when moderators race only the
+	// winner acts. The report is reopened if the action then fails.
+	open := *report
+	report.Resolve(req.Action, moderatorID, req.Note)
+	if err := h.store.ResolveReport(ctx, report); err != nil {
+		if errors.Is(err, store.ErrReportResolved) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to resolve report")
+	}
+
+	switch req.Action {
+	case models.ReportActionDeleteMessage:
+		err = h.deleteMessage(ctx, report, moderatorID)
+	case models.ReportActionRemoveMember:
+		err = h.removeMember(ctx, report)
+	case models.ReportActionSuspendUser:
+		err = h.suspendUser(ctx, report, moderatorID, req.SuspendSeconds)
+	}
+	if err != nil {
+		if reopenErr := h.store.ReopenReport(ctx, &open, report.Status); reopenErr != nil {
+			log.Printf("failed to reopen report %s: %v", report.ID, reopenErr)
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// checkReportAction rejects actions that don't apply to a report before it
+// is claimed.
+func checkReportAction(report *models.Report, req *ResolveReportRequest) error {
+	switch req.Action {
+	case models.ReportActionDeleteMessage:
+		if report.MessageID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "report is not about a message")
+		}
+	case models.ReportActionRemoveMember:
+		if report.Message == nil || report.Message.Type != models.MessageTypeGroup {
+			return echo.NewHTTPError(http.StatusBadRequest, "report is not about a group message")
+		}
+	case models.ReportActionSuspendUser:
+		if req.SuspendSeconds > maxSuspendSeconds {
+			return echo.NewHTTPError(http.StatusBadRequest, "suspend_seconds is too long; omit it to suspend indefinitely")
+		}
+	}
+	return nil
+}
+
+// LiftSuspension ends a user's suspension early.
+func (h *ReportHandler) LiftSuspension(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user, err := h.store.GetUserByID(ctx, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if err := h.store.LiftSuspension(ctx, user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to lift suspension")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *ReportHandler) messageContext(ctx context.Context, msg *models.Message) (*store.MessageWindow, error) {
+	anchor := store.MessageAnchor{MessageID: msg.ID}
+	switch msg.Type {
+	case models.MessageTypePrivate:
+		return h.store.GetPrivateMessagesAround(ctx, msg.FromID, msg.ToID, anchor, reportContextSize, reportContextSize)
+	case models.MessageTypeGroup:
+		return h.store.GetGroupMessagesAround(ctx, msg.GroupID, anchor, reportContextSize, reportContextSize)
+	default:
+		return h.store.GetBroadcastMessagesAround(ctx, anchor, reportContextSize, reportContextSize)
+	}
+}
+
+// deleteMessage deletes the reported message and tells its conversation.
+// A message that is already gone counts as deleted.
+func (h *ReportHandler) deleteMessage(ctx context.Context, report *models.Report, moderatorID string) error {
+	msg, err := h.store.DeleteMessage(ctx, report.MessageID)
+	if err != nil {
+		if errors.Is(err, store.ErrMessageNotFound) {
+			return nil
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete message")
+	}
+
+	event := models.NewEvent(models.EventMessageDeleted, msg.ConversationID(), moderatorID)
+	event.MessageID = msg.ID
+	if err := h.store.PublishEvent(ctx, event); err != nil {
+		log.Printf("failed to publish deletion of message %s: %v", msg.ID, err)
+	}
+	return nil
+}
+
+// removeMember removes the reported user from the group the reported message
+// was sent to.
+func (h *ReportHandler) removeMember(ctx context.Context, report *models.Report) error {
+	group, err := h.store.GetGroup(ctx, report.Message.GroupID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "group not found")
+	}
+	if err := removeGroupMember(ctx, h.store, group, report.UserID); err != nil {
+		switch {
+		case errors.Is(err, errCannotRemoveCreator):
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case errors.Is(err, errUserNotMember):
+			// Already gone
+			return nil
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove member from group")
+	}
+	return nil
+}
+
+func (h *ReportHandler) suspendUser(ctx context.Context, report *models.Report, moderatorID string, seconds int) error {
+	suspension := &models.Suspension{
+		UserID:      report.UserID,
+		Reason:      report.Reason,
+		SuspendedBy: moderatorID,
+		SuspendedAt: time.Now(),
+	}
+	if seconds > 0 {
+		until := suspension.SuspendedAt.Add(time.Duration(seconds) * time.Second)
+		suspension.Until = &until
+	}
+
+	previous, err := h.store.GetSuspension(ctx, report.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to suspend user")
+	}
+	if err := h.store.SuspendUser(ctx, suspension); err != nil {
+		if errors.Is(err, store.ErrSuspensionEnded) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to suspend user")
+	}
+	// End the user's sessions, including open WebSockets. If that fails the
+	// report is reopened, so the suspension is undone with it.
+	if err := h.store.RevokeUserTokens(ctx, report.UserID); err != nil {
+		h.restoreSuspension(context.WithoutCancel(ctx), report.UserID, previous)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke the user's sessions")
+	}
+	return nil
+}
+
+// restoreSuspension puts back the suspension, or lack of one, that a failed
+// suspend action replaced.
+func (h *ReportHandler) restoreSuspension(ctx context.Context, userID string, previous *models.Suspension) {
+	var err error
+	if previous != nil {
+		err = h.store.SuspendUser(ctx, previous)
+	}
+	if previous == nil || errors.Is(err, store.ErrSuspensionEnded) {
+		err = h.store.LiftSuspension(ctx, userID)
+	}
+	if err != nil {
+		log.Printf("failed to undo suspension of user %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/search"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	maxSearchResults = 100
+	maxSearchTerms   = 10
+)
+
+type SearchHandler struct {
+	store *store.RedisStore
+}
+
+func NewSearchHandler(store *store.RedisStore) *SearchHandler {
+	return &SearchHandler{
+		store: store,
+	}
+}
+
+// Search handles GET /api/search?q=. Optional filters: conversation_id, from
+// (sender ID), since and until (RFC 3339), has_attachment and limit.
+func (h *SearchHandler) Search(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	terms := search.Tokenize(c.QueryParam("q"))
+	if len(terms) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "q must contain at least one word")
+	}
+	if len(terms) > maxSearchTerms {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("q must contain at most %d words", maxSearchTerms))
+	}
+
+	limit, err := queryInt(c, "limit", 20)
+	if err != nil || limit < 1 || limit > maxSearchResults {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+
+	query := store.SearchQuery{
+		Terms:  terms,
+		FromID: c.QueryParam("from"),
+		Limit:  int(limit),
+	}
+	if query.Since, err = queryTime(c, "since"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid since")
+	}
+	if query.Until, err = queryTime(c, "until"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid until")
+	}
+	if value := c.QueryParam("has_attachment"); value != "" {
+		if query.HasAttachments, err = strconv.ParseBool(value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid has_attachment")
+		}
+	}
+
+	query.ConversationIDs, err = h.readableConversations(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to search messages")
+	}
+	if conversationID := c.QueryParam("conversation_id"); conversationID != "" {
+		if !slices.Contains(query.ConversationIDs, conversationID) {
+			return echo.NewHTTPError(http.StatusForbidden, "no access to this conversation")
+		}
+		query.ConversationIDs = []string{conversationID}
+	}
+
+	messages, err := h.store.SearchMessages(ctx, query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to search messages")
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+// readableConversations lists every conversation userID may search: the
+// broadcast channel, their groups and their private chats.
+func (h *SearchHandler) readableConversations(ctx context.Context, userID string) ([]string, error) {
+	conversations := []string{models.BroadcastConversationID}
+
+	groups, err := h.store.GetUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		conversations = append(conversations, models.GroupConversationID(group.ID))
+	}
+
+	partners, err := h.store.GetPrivatePartners(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, partnerID := range partners {
+		conversations = append(conversations, models.PrivateConversationID(userID, partnerID))
+	}
+
+	return conversations, nil
+}
+
+func queryTime(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
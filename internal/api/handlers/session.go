@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/auth"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+type SessionHandler struct {
+	store  *store.RedisStore
+	issuer *auth.Issuer
+}
+
+func NewSessionHandler(store *store.RedisStore, issuer *auth.Issuer) *SessionHandler {
+	return &SessionHandler{
+		store:  store,
+		issuer: issuer,
+	}
+}
+
+type SessionResponse struct {
+	*models.Session
+	Current bool `json:"current"` // The session of the token making the request
+}
+
+// ListSessions lists the devices the caller is logged in on, most recently
+// active first.
+func (h *SessionHandler) ListSessions(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	claims := c.Get("claims").(*middleware.JWTClaims)
+
+	sessions, err := h.store.GetUserSessions(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch sessions")
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Session: session,
+			Current: session.ID == claims.SessionID,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession logs the caller out on one device, closing its WebSockets.
+func (h *SessionHandler) RevokeSession(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	session, err := h.store.GetSession(ctx, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch session")
+	}
+	if session.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, store.ErrSessionNotFound.Error())
+	}
+
+	if err := h.issuer.RevokeSession(ctx, userID, session.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke session")
+	}
+
+	event := newAuditEvent(c, models.AuditSessionRevoked)
+	event.UserID = userID
+	event.Username = c.Get("username").(string)
+	event.Detail = session.DeviceName
+	recordAudit(c, h.store, event)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// newDevice describes the client making the request.
+func newDevice(c echo.Context, name string) auth.Device {
+	return auth.Device{
+		Name:      name,
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/service"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const maxStarsPageSize = 100
+
+type StarHandler struct {
+	store *store.RedisStore
+}
+
+func NewStarHandler(store *store.RedisStore) *StarHandler {
+	return &StarHandler{
+		store: store,
+	}
+}
+
+func (h *StarHandler) StarMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	msg, err := h.store.GetMessage(ctx, c.Param("messageID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
+	canRead, err := service.CanReadMessage(ctx, h.store, userID, msg)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check message access")
+	}
+	if !canRead {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
+
+	star := models.NewStar(msg)
+	if err := h.store.StarMessage(ctx, userID, star); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to star message")
+	}
+	star.Message = msg
+
+	return c.JSON(http.StatusCreated, star)
+}
+
+func (h *StarHandler) UnstarMessage(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+
+	if err := h.store.UnstarMessage(c.Request().Context(), userID, c.Param("messageID")); err != nil {
+		if errors.Is(err, store.ErrNotStarred) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unstar message")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListStars supports ?conversation_id= to filter and ?offset=&limit= to page.
+func (h *StarHandler) ListStars(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+	}
+	limit, err := queryInt(c, "limit", 50)
+	if err != nil || limit < 1 || limit > maxStarsPageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+
+	stars, err := h.store.GetStars(ctx, userID, c.QueryParam("conversation_id"), offset, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get stars")
+	}
+
+	// Hide bodies of messages the user can no longer read, e.g. after
+	// leaving a group.
+	for _, star := range stars {
+		if star.Message == nil {
+			continue
+		}
+		canRead, err := service.CanReadMessage(ctx, h.store, userID, star.Message)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check message access")
+		}
+		if !canRead {
+			star.Message = nil
+		}
+	}
+
+	return c.JSON(http.StatusOK, stars)
+}
+
+func queryInt(c echo.Context, name string, def int64) (int64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
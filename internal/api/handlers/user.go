@@ -1,24 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 
 	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/auth"
 	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/password"
+	"github.com/bm-197/go-chat/internal/ratelimit"
 	"github.com/bm-197/go-chat/internal/store"
 )
 
 type UserHandler struct {
 	store     *store.RedisStore
-	jwtSecret string
+	issuer    *auth.Issuer
+	guard     *auth.LoginGuard
+	passwords *password.Manager
 }
 
-func NewUserHandler(store *store.RedisStore, jwtSecret string) *UserHandler {
+func NewUserHandler(store *store.RedisStore, issuer *auth.Issuer, guard *auth.LoginGuard, passwords *password.Manager) *UserHandler {
 	return &UserHandler{
 		store:     store,
-		jwtSecret: jwtSecret,
+		issuer:    issuer,
+		guard:     guard,
+		passwords: passwords,
 	}
 }
 
@@ -28,14 +38,40 @@ type RegisterRequest struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Username   string `json:"username" validate:"required"`
+	Password   string `json:"password" validate:"required"`
+	DeviceName string `json:"device_name" validate:"max=64"` // Optional, shown in the session list
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type LoginMFARequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"` // TOTP or recovery code
+	DeviceName     string `json:"device_name" validate:"max=64"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 type AuthResponse struct {
-	Token    string `json:"token"`
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until Token expires
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+}
+
+// MFAChallengeResponse is returned by Login instead of tokens when the user
+// has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"` // Seconds until ChallengeToken expires
 }
 
 type RegisterResponse struct {
@@ -53,10 +89,14 @@ func (h *UserHandler) Register(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	user, err := models.NewUser(req.Username, req.Password)
+	if err := h.passwords.Validate(req.Password, req.Username); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	hash, err := h.passwords.Hash(req.Password)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create user")
 	}
+	user := models.NewUser(req.Username, hash)
 
 	if err := h.store.SaveUser(c.Request().Context(), user); err != nil {
 		if err.Error() == "username already exists" {
@@ -81,25 +121,350 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	user, err := h.store.GetUserByUsername(c.Request().Context(), req.Username)
+	ctx := c.Request().Context()
+	if err := checkLockout(c, h.store, h.guard, req.Username); err != nil {
+		return err
+	}
+
+	// Unknown usernames still cost a password check, so response times
+	// don't reveal which usernames exist.
+	user, err := h.store.GetUserByUsername(ctx, req.Username)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+		h.passwords.Simulate(req.Password)
+		return h.loginFailed(c, req.Username, "")
+	}
+	if !user.HasPassword() {
+		h.passwords.Simulate(req.Password)
+		return h.loginFailed(c, req.Username, user.ID)
 	}
 
 	if !user.ValidatePassword(req.Password) {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+		return h.loginFailed(c, req.Username, user.ID)
+	}
+	h.rehashPassword(c, user, req.Password)
+
+	suspension, err := h.store.GetSuspension(c.Request().Context(), user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check account status")
+	}
+	if suspension != nil {
+		return echo.NewHTTPError(http.StatusForbidden, "account suspended")
+	}
+
+	challenge, err := challengeMFA(c, h.store, h.issuer, user)
+	if err != nil {
+		return err
+	}
+	if challenge != nil {
+		return c.JSON(http.StatusOK, challenge)
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username, h.jwtSecret)
+	tokens, err := h.issuer.Issue(c.Request().Context(), user, newDevice(c, req.DeviceName))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate token")
 	}
+	h.loginSucceeded(c, user)
 
-	return c.JSON(http.StatusOK, AuthResponse{
-		Token:    token,
-		UserID:   user.ID,
-		Username: user.Username,
-	})
+	return c.JSON(http.StatusOK, newAuthResponse(tokens))
+}
+
+// checkLockout refuses a login, or a second factor, for a username or IP
+// that is locked out after too many failures.
+func checkLockout(c echo.Context, s *store.RedisStore, guard *auth.LoginGuard, username string) error {
+	lockout, err := guard.Check(c.Request().Context(), username, c.RealIP())
+	if err != nil {
+		log.Printf("login lockout check failed, allowing attempt: %v", err)
+	}
+	if lockout == 0 {
+		return nil
+	}
+
+	event := newAuditEvent(c, models.AuditLoginLocked)
+	event.Username = username
+	recordAudit(c, s, event)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(ratelimit.Seconds(lockout)))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed login attempts")
+}
+
+// secondFactorFailed counts a wrong TOTP or recovery code towards the user's
+// login lockout, like a wrong password, and records it.
+func secondFactorFailed(c echo.Context, s *store.RedisStore, guard *auth.LoginGuard, user *models.User, cause error) {
+	event := newAuditEvent(c, models.AuditMFAFailed)
+	event.UserID = user.ID
+	event.Username = user.Username
+	event.Detail = cause.Error()
+
+	lockout, err := guard.Failed(c.Request().Context(), user.Username, c.RealIP())
+	if err != nil {
+		log.Printf("failed to record failed second factor for %s: %v", user.Username, err)
+	}
+	if lockout > 0 {
+		event.Detail += "; locked out for " + lockout.String()
+	}
+	recordAudit(c, s, event)
+}
+
+// challengeMFA starts a second-factor challenge if the user has two-factor
+// authentication enabled. A nil response means tokens can be issued.
+func challengeMFA(c echo.Context, s *store.RedisStore, issuer *auth.Issuer, user *models.User) (*MFAChallengeResponse, error) {
+	totp, err := s.GetTOTP(c.Request().Context(), user.ID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to check two-factor authentication")
+	}
+	if totp == nil || !totp.Enabled {
+		return nil, nil
+	}
+
+	challenge, err := issuer.Challenge(c.Request().Context(), user)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to start two-factor authentication")
+	}
+	return &MFAChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: challenge,
+		ExpiresIn:      int(auth.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// rehashPassword moves a user whose password was hashed with older settings
+// to the current ones, now that the plaintext is known. Failing to only
+// delays it to the next login.
+func (h *UserHandler) rehashPassword(c echo.Context, user *models.User, plaintext string) {
+	if !h.passwords.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := h.passwords.Hash(plaintext)
+	if err != nil {
+		log.Printf("failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	// Only the hash is written, and only if the password wasn't changed
+	// since the user was loaded.
+	if _, err := h.store.ReplacePassword(c.Request().Context(), user.ID, user.Password, hash); err != nil {
+		log.Printf("failed to save rehashed password of user %s: %v", user.ID, err)
+	}
+}
+
+// loginFailed counts a failed login towards lockouts and records it. userID
+// is empty for unknown usernames.
+func (h *UserHandler) loginFailed(c echo.Context, username, userID string) error {
+	event := newAuditEvent(c, models.AuditLoginFailed)
+	event.UserID = userID
+	event.Username = username
+
+	lockout, err := h.guard.Failed(c.Request().Context(), username, c.RealIP())
+	if err != nil {
+		log.Printf("failed to record failed login for %s: %v", username, err)
+	}
+	if lockout > 0 {
+		event.Detail = "locked out for " + lockout.String()
+	}
+	recordAudit(c, h.store, event)
+
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+}
+
+// loginSucceeded clears the user's failed logins once every factor has been
+// checked, and records the login.
+func (h *UserHandler) loginSucceeded(c echo.Context, user *models.User) {
+	if err := h.guard.Succeeded(c.Request().Context(), user.Username); err != nil {
+		log.Printf("failed to clear failed logins for %s: %v", user.Username, err)
+	}
+
+	event := newAuditEvent(c, models.AuditLoginSucceeded)
+	event.UserID = user.ID
+	event.Username = user.Username
+	recordAudit(c, h.store, event)
+}
+
+// LoginMFA completes a login that needs a second factor, exchanging the
+// challenge token from Login and a TOTP or recovery code for tokens.
+func (h *UserHandler) LoginMFA(c echo.Context) error {
+	var req LoginMFARequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	user, err := h.issuer.ChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidChallenge) {
+			event := newAuditEvent(c, models.AuditMFAFailed)
+			event.Detail = err.Error()
+			recordAudit(c, h.store, event)
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify code")
+	}
+	if err := checkLockout(c, h.store, h.guard, user.Username); err != nil {
+		return err
+	}
+
+	tokens, err := h.issuer.CompleteChallenge(ctx, req.ChallengeToken, req.Code, newDevice(c, req.DeviceName))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidChallenge), errors.Is(err, auth.ErrInvalidCode):
+			secondFactorFailed(c, h.store, h.guard, user, err)
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		case errors.Is(err, auth.ErrAccountSuspended):
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate token")
+	}
+
+	h.loginSucceeded(c, tokens.User)
+
+	return c.JSON(http.StatusOK, newAuthResponse(tokens))
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh
+// token. Each refresh token can be used once.
+func (h *UserHandler) RefreshToken(c echo.Context) error {
+	var req RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	tokens, err := h.issuer.Refresh(c.Request().Context(), req.RefreshToken, newDevice(c, ""))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to refresh token")
+	}
+
+	return c.JSON(http.StatusOK, newAuthResponse(tokens))
+}
+
+// Logout revokes the caller's token, its refresh token and the WebSockets
+// opened with it.
+func (h *UserHandler) Logout(c echo.Context) error {
+	claims := c.Get("claims").(*middleware.JWTClaims)
+	if err := h.issuer.Logout(c.Request().Context(), claims); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to log out")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutEverywhere revokes every token and WebSocket of the caller, on all
+// devices.
+func (h *UserHandler) LogoutEverywhere(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	if err := h.issuer.LogoutEverywhere(c.Request().Context(), userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to log out")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func newAuthResponse(tokens *auth.TokenPair) AuthResponse {
+	return AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		UserID:       tokens.User.ID,
+		Username:     tokens.User.Username,
+	}
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session of the user is logged out; the caller gets a new token
+// pair to carry on with.
+func (h *UserHandler) ChangePassword(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	ctx := c.Request().Context()
+
+	var req ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if !user.HasPassword() {
+		return echo.NewHTTPError(http.StatusConflict, "account has no password")
+	}
+	// Guesses at the current password count towards the login lockout, so
+	// a stolen access token can't be used to find the password.
+	if err := checkLockout(c, h.store, h.guard, user.Username); err != nil {
+		return err
+	}
+	if !user.ValidatePassword(req.CurrentPassword) {
+		event := newAuditEvent(c, models.AuditPasswordChangeFailed)
+		event.UserID = user.ID
+		event.Username = user.Username
+		lockout, err := h.guard.Failed(ctx, user.Username, c.RealIP())
+		if err != nil {
+			log.Printf("failed to record failed password change for %s: %v", user.Username, err)
+		}
+		if lockout > 0 {
+			event.Detail = "locked out for " + lockout.String()
+		}
+		recordAudit(c, h.store, event)
+		return echo.NewHTTPError(http.StatusUnauthorized, "current password is incorrect")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return echo.NewHTTPError(http.StatusBadRequest, "new password must differ from the current one")
+	}
+	if err := h.passwords.Validate(req.NewPassword, user.Username); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	hash, err := h.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to change password")
+	}
+	// Only the hash is written, and only if the password wasn't changed
+	// since it was checked.
+	replaced, err := h.store.ReplacePassword(ctx, user.ID, user.Password, hash)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to change password")
+	}
+	if !replaced {
+		return echo.NewHTTPError(http.StatusConflict, "password was changed concurrently")
+	}
+	user.Password = hash
+
+	if err := h.store.DeleteEmailToken(ctx, models.EmailTokenPasswordReset, user.ID); err != nil {
+		log.Printf("failed to revoke password reset of user %s: %v", user.ID, err)
+	}
+	// The caller's new session keeps the name of the one it replaces.
+	device := newDevice(c, "")
+	claims := c.Get("claims").(*middleware.JWTClaims)
+	if session, err := h.store.GetSession(ctx, claims.SessionID); err == nil {
+		device.Name = session.DeviceName
+	}
+
+	if err := h.issuer.LogoutEverywhere(ctx, user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to log out other sessions")
+	}
+	tokens, err := h.issuer.Issue(ctx, user, device)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate token")
+	}
+
+	event := newAuditEvent(c, models.AuditPasswordChanged)
+	event.UserID = user.ID
+	event.Username = user.Username
+	recordAudit(c, h.store, event)
+
+	return c.JSON(http.StatusOK, newAuthResponse(tokens))
 }
 
 func (h *UserHandler) GetProfile(c echo.Context) error {
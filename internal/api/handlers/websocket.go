@@ -3,17 +3,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"slices"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 
+	"github.com/bm-197/go-chat/internal/api/middleware"
 	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/ratelimit"
+	"github.com/bm-197/go-chat/internal/service"
 	"github.com/bm-197/go-chat/internal/store"
 )
 
@@ -29,38 +33,172 @@ var (
 
 type WebSocketHandler struct {
 	store      *store.RedisStore
+	service    *service.MessageService
+	plugins    *plugin.Registry
+	limiter    *ratelimit.Limiter
 	clients    map[string]*websocket.Conn
 	clientsMux sync.RWMutex
 }
 
-func NewWebSocketHandler(store *store.RedisStore) *WebSocketHandler {
+func NewWebSocketHandler(store *store.RedisStore, service *service.MessageService, plugins *plugin.Registry, limiter *ratelimit.Limiter) *WebSocketHandler {
 	return &WebSocketHandler{
 		store:   store,
+		service: service,
+		plugins: plugins,
+		limiter: limiter,
 		clients: make(map[string]*websocket.Conn),
 	}
 }
 
+// wsOpPollVote is a client frame type for voting on a poll, handled
+// alongside the message types.
+const wsOpPollVote models.MessageType = "poll_vote"
+
 type Message struct {
-	Type     models.MessageType `json:"type"`               // "private", "group, or "broadcast"
-	GroupID  string             `json:"group_id,omitempty"` // Required for group messages
-	To       string             `json:"to,omitempty"`       // Required for private messages
-	Content  string             `json:"content"`
-	From     string             `json:"from,omitempty"`
-	FromUser string             `json:"from_user,omitempty"`
+	Type        models.MessageType  `json:"type"`               // "private", "group, "broadcast" or "poll_vote"
+	GroupID     string              `json:"group_id,omitempty"` // Required for group messages
+	To          string              `json:"to,omitempty"`       // Required for private messages
+	Content     string              `json:"content"`
+	SendAt      *time.Time          `json:"send_at,omitempty"` // Optional, schedules the message
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+	ClientMsgID string              `json:"client_msg_id,omitempty"` // Optional, dedupes retried sends
+	From        string              `json:"from,omitempty"`
+	FromUser    string              `json:"from_user,omitempty"`
+	// Poll votes
+	MessageID string `json:"message_id,omitempty"`
+	Options   []int  `json:"options,omitempty"`
+}
+
+// wsError is sent to a client when one of its frames is refused. Its type
+// never collides with a message or event type.
+type wsError struct {
+	Type        string `json:"type"` // Always "error"
+	Code        string `json:"code"`
+	Error       string `json:"error"`
+	RetryAfter  int    `json:"retry_after,omitempty"` // Seconds
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+// wsErrorCodes names the HTTP statuses of errors shared with the REST
+// handlers in error frames.
+var wsErrorCodes = map[int]string{
+	http.StatusBadRequest:          "invalid",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "rejected",
+}
+
+// httpErrorFrame turns an error from the helpers shared with the REST
+// handlers into an error frame, so both transports report failures alike.
+func httpErrorFrame(err error, clientMsgID string) wsError {
+	frame := wsError{
+		Code:        "internal",
+		Error:       http.StatusText(http.StatusInternalServerError),
+		ClientMsgID: clientMsgID,
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		frame.Error = fmt.Sprint(httpErr.Message)
+		if code, ok := wsErrorCodes[httpErr.Code]; ok {
+			frame.Code = code
+		}
+	}
+	return frame
+}
+
+// wsAck confirms a send to the client that made it, so the client can match
+// its client_msg_id to the stored message even when no copy of the message
+// is delivered back to it.
+type wsAck struct {
+	Type        string `json:"type"` // Always "ack"
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	MessageID   string `json:"message_id"`
+	Scheduled   bool   `json:"scheduled,omitempty"`
+	Duplicate   bool   `json:"duplicate,omitempty"` // An earlier send with the same client_msg_id won
+}
+
+// wsConn serializes writes, since a connection supports only one concurrent
+// writer, and remembers the token it was opened with.
+type wsConn struct {
+	*websocket.Conn
+	claims  *middleware.JWTClaims
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) revokedBy(revocation *store.TokenRevocation) bool {
+	return (revocation.TokenID != "" && revocation.TokenID == c.claims.ID) ||
+		(revocation.SessionID != "" && revocation.SessionID == c.claims.SessionID) ||
+		c.claims.Version < revocation.MinVersion
+}
+
+// close tells the client why the connection ends and closes it, which also
+// ends the read loop.
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	if err := c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline); err != nil {
+		log.Printf("failed to write websocket close: %v", err)
+	}
+	c.Close()
+}
+
+func (c *wsConn) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *wsConn) writeError(frame wsError) error {
+	frame.Type = "error"
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+func (c *wsConn) writeAck(frame wsAck) error {
+	frame.Type = "ack"
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+// frameClientMsgID returns the client_msg_id of a frame that hasn't been
+// parsed yet, or "" if it has none or is malformed.
+func frameClientMsgID(frame []byte) string {
+	var ids struct {
+		ClientMsgID string `json:"client_msg_id"`
+	}
+	json.Unmarshal(frame, &ids)
+	return ids.ClientMsgID
 }
 
 func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
 	userID := c.Get("user_id").(string)
 	username := c.Get("username").(string)
 
-	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to upgrade connection: %w", err)
 	}
-	defer ws.Close()
+	defer conn.Close()
+	ws := &wsConn{Conn: conn, claims: c.Get("claims").(*middleware.JWTClaims)}
+	// The connection belongs to the session of its token: revoking the
+	// session closes it, and opening it counts as activity. Bots' API keys
+	// have no session.
+	if err := h.store.TouchSession(c.Request().Context(), ws.claims.SessionID, c.RealIP(), c.Request().UserAgent(), 0); err != nil && !errors.Is(err, store.ErrSessionNotFound) {
+		log.Printf("failed to update session %s: %v", ws.claims.SessionID, err)
+	}
+	// Bots whose API key may only read get messages but can't send.
+	canSend := middleware.HasScope(c, models.ScopeMessagesWrite)
 
 	h.clientsMux.Lock()
-	h.clients[userID] = ws
+	h.clients[userID] = conn
 	h.clientsMux.Unlock()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -78,38 +216,97 @@ func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
 			break
 		}
 
+		// Every frame counts against the same budget as sends over HTTP,
+		// before it's parsed, so malformed frames are throttled too.
+		limit, err := h.limiter.Allow(ctx, ratelimit.Send, "user:"+userID)
+		if err != nil {
+			log.Printf("rate limiting failed, allowing frame: %v", err)
+		} else if !limit.Allowed {
+			if err := ws.writeError(wsError{
+				Code:        "rate_limited",
+				Error:       "rate limit exceeded",
+				RetryAfter:  ratelimit.Seconds(limit.RetryAfter),
+				ClientMsgID: frameClientMsgID(msgBytes),
+			}); err != nil {
+				log.Printf("failed to write websocket message: %v", err)
+				break
+			}
+			continue
+		}
+
 		var msg Message
 		if err := json.Unmarshal(msgBytes, &msg); err != nil {
-			log.Printf("error unmarshaling message: %v", err)
+			if err := ws.writeError(wsError{
+				Code:  "invalid",
+				Error: "malformed frame",
+			}); err != nil {
+				log.Printf("failed to write websocket message: %v", err)
+				break
+			}
 			continue
 		}
 
 		msg.From = userID
 		msg.FromUser = username
 
-		if !msg.Type.IsValid() {
-			log.Printf("invalid message type: %s", msg.Type)
+		if !canSend {
+			if err := ws.writeError(wsError{
+				Code:        "forbidden",
+				Error:       "API key lacks the " + string(models.ScopeMessagesWrite) + " scope",
+				ClientMsgID: msg.ClientMsgID,
+			}); err != nil {
+				log.Printf("failed to write websocket message: %v", err)
+				break
+			}
 			continue
 		}
 
-		switch msg.Type {
-		case models.MessageTypePrivate:
-			if err := h.handlePrivateMessage(msg); err != nil {
-				log.Printf("error handling private message: %v", err)
+		if msg.Type == wsOpPollVote {
+			if _, err := castVote(ctx, h.store, userID, msg.MessageID, msg.Options); err != nil {
+				if err := ws.writeError(httpErrorFrame(voteError(err), msg.ClientMsgID)); err != nil {
+					log.Printf("failed to write websocket message: %v", err)
+					break
+				}
 			}
+			continue
+		}
 
-		case models.MessageTypeGroup:
-			if err := h.handleGroupMessage(msg); err != nil {
-				log.Printf("error handling group message: %v", err)
+		if !msg.Type.IsValid() {
+			if err := ws.writeError(wsError{
+				Code:        "invalid",
+				Error:       "invalid message type",
+				ClientMsgID: msg.ClientMsgID,
+			}); err != nil {
+				log.Printf("failed to write websocket message: %v", err)
+				break
 			}
+			continue
+		}
 
-		case models.MessageTypeBroadcast:
-			if err := h.handleBroadcast(msg); err != nil {
-				log.Printf("error handling broadcast: %v", err)
+		result, err := h.service.Send(ctx, userID, username, service.SendRequest{
+			Type:        msg.Type,
+			Content:     msg.Content,
+			ToUsername:  msg.To,
+			GroupID:     msg.GroupID,
+			Attachments: msg.Attachments,
+			SendAt:      msg.SendAt,
+			ClientMsgID: msg.ClientMsgID,
+		})
+		if err != nil {
+			if err := ws.writeError(httpErrorFrame(serviceError(err, "failed to send message"), msg.ClientMsgID)); err != nil {
+				log.Printf("failed to write websocket message: %v", err)
+				break
 			}
-
-		default:
-			log.Printf("unknown message type: %s", msg.Type)
+			continue
+		}
+		if err := ws.writeAck(wsAck{
+			ClientMsgID: msg.ClientMsgID,
+			MessageID:   result.Message.ID,
+			Scheduled:   result.Scheduled,
+			Duplicate:   result.Duplicate,
+		}); err != nil {
+			log.Printf("failed to write websocket message: %v", err)
+			break
 		}
 	}
 
@@ -120,15 +317,17 @@ func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
 	return nil
 }
 
-func (h *WebSocketHandler) listenPubSub(ctx context.Context, userID string, ws *websocket.Conn) {
+func (h *WebSocketHandler) listenPubSub(ctx context.Context, userID string, ws *wsConn) {
 	groups, err := h.store.GetUserGroups(ctx, userID)
 	if err != nil {
 		log.Printf("failed to fetch user groups for subscriptions: %v", err)
 	}
 
+	revocationChannel := store.RevocationChannel(userID)
 	channels := []string{
 		"broadcast",
 		fmt.Sprintf("user:%s", userID),
+		revocationChannel,
 	}
 
 	for _, g := range groups {
@@ -139,8 +338,6 @@ func (h *WebSocketHandler) listenPubSub(ctx context.Context, userID string, ws *
 
 	defer pubsub.Close()
 
-	var writeMu sync.Mutex
-
 	ch := pubsub.Channel()
 	for {
 		select {
@@ -151,86 +348,28 @@ func (h *WebSocketHandler) listenPubSub(ctx context.Context, userID string, ws *
 				return
 			}
 
-			writeMu.Lock()
-			if err := ws.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-				writeMu.Unlock()
+			if msg.Channel == revocationChannel {
+				var revocation store.TokenRevocation
+				if err := json.Unmarshal([]byte(msg.Payload), &revocation); err != nil {
+					log.Printf("failed to unmarshal revocation: %v", err)
+					continue
+				}
+				if ws.revokedBy(&revocation) {
+					ws.close(websocket.ClosePolicyViolation, "session revoked")
+					return
+				}
+				continue
+			}
+
+			payload, ok := h.plugins.PreDeliver(ctx, userID, msg.Channel, []byte(msg.Payload))
+			if !ok {
+				continue
+			}
+
+			if err := ws.write(payload); err != nil {
 				log.Printf("failed to write websocket message: %v", err)
 				return
 			}
-			writeMu.Unlock()
 		}
 	}
 }
-
-func (h *WebSocketHandler) handlePrivateMessage(msg Message) error {
-	recipient, err := h.store.GetUserByUsername(context.Background(), msg.To)
-	if err != nil {
-		return fmt.Errorf("recipient not found: %w", err)
-	}
-
-	message := &models.Message{
-		Type:      models.MessageTypePrivate,
-		Content:   msg.Content,
-		FromID:    msg.From,
-		FromUser:  msg.FromUser,
-		ToID:      recipient.ID,
-		Timestamp: time.Now(),
-	}
-	if err := h.store.SaveMessage(context.Background(), message); err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
-	}
-
-	if err := h.store.PublishMessage(context.Background(), message); err != nil {
-		log.Printf("failed to publish private message: %v", err)
-	}
-
-	return nil
-}
-
-func (h *WebSocketHandler) handleGroupMessage(msg Message) error {
-	group, err := h.store.GetGroup(context.Background(), msg.GroupID)
-	if err != nil {
-		return fmt.Errorf("failed to get group: %w", err)
-	}
-
-	isMember := slices.Contains(group.Members, msg.From)
-
-	if !isMember {
-		return fmt.Errorf("user is not a member of the group")
-	}
-
-	message := &models.Message{
-		Type:      models.MessageTypeGroup,
-		Content:   msg.Content,
-		FromID:    msg.From,
-		FromUser:  msg.FromUser,
-		GroupID:   msg.GroupID,
-		Timestamp: time.Now(),
-	}
-	if err := h.store.SaveMessage(context.Background(), message); err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
-	}
-	if err := h.store.PublishMessage(context.Background(), message); err != nil {
-		log.Printf("failed to publish group message: %v", err)
-	}
-
-	return nil
-}
-
-func (h *WebSocketHandler) handleBroadcast(msg Message) error {
-	message := &models.Message{
-		Type:      models.MessageTypeBroadcast,
-		Content:   msg.Content,
-		FromID:    msg.From,
-		FromUser:  msg.FromUser,
-		Timestamp: time.Now(),
-	}
-	if err := h.store.SaveMessage(context.Background(), message); err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
-	}
-	if err := h.store.PublishMessage(context.Background(), message); err != nil {
-		log.Printf("failed to publish broadcast message: %v", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+// APIKeyPrefix starts every API key, so AuthMiddleware can tell API keys
+// from access tokens.
+const APIKeyPrefix = "gck_"
+
+// APIKeyScopes lists the routes that accept API keys, by method and path,
+// and the scope each needs. Every other route takes a user's access token.
+type APIKeyScopes map[string]models.APIScope
+
+// Allow lets API keys with scope use route.
+func (s APIKeyScopes) Allow(route *echo.Route, scope models.APIScope) {
+	s[route.Method+" "+route.Path] = scope
+}
+
+func (s APIKeyScopes) scope(c echo.Context) models.APIScope {
+	return s[c.Request().Method+" "+c.Path()]
+}
+
+// HasScope reports whether the request may use scope. Requests with an
+// access token may use every scope.
+func HasScope(c echo.Context, scope models.APIScope) bool {
+	key, ok := c.Get("api_key").(*models.APIKey)
+	return !ok || key.HasScope(scope)
+}
+
+// GenerateAPIKey returns a new API key and the hash to store it by.
+func GenerateAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateAPIKey authenticates a bot by API key. The request's claims
+// use the key ID as session ID, so revoking the key closes its WebSockets.
+func authenticateAPIKey(c echo.Context, config JWTConfig, apiKey string) error {
+	ctx := c.Request().Context()
+
+	scope := config.APIKeyScopes.scope(c)
+	if scope == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "API keys can't be used here")
+	}
+
+	key, err := config.Store.GetAPIKey(ctx, HashAPIKey(apiKey))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+	}
+	if !key.HasScope(scope) {
+		return echo.NewHTTPError(http.StatusForbidden, "API key lacks the "+string(scope)+" scope")
+	}
+	bot, err := config.Store.GetUserByID(ctx, key.BotID)
+	if err != nil || !bot.IsBot {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+	}
+	if err := config.Store.TouchAPIKey(ctx, key, time.Now()); err != nil {
+		log.Printf("failed to record use of API key %s: %v", key.ID, err)
+	}
+
+	c.Set("user_id", bot.ID)
+	c.Set("username", bot.Username)
+	c.Set("claims", &JWTClaims{UserID: bot.ID, Username: bot.Username, SessionID: key.ID})
+	c.Set("api_key", key)
+	return nil
+}
@@ -1,22 +1,34 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/keys"
+	"github.com/bm-197/go-chat/internal/store"
 )
 
+// AccessTokenTTL is kept short so stolen tokens are useful only briefly;
+// clients renew them with a refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
 type JWTConfig struct {
-	SecretKey string
+	Keys *keys.Ring
+	// Store is consulted for revoked tokens and API keys.
+	Store        *store.RedisStore
+	APIKeyScopes APIKeyScopes
 }
 
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"` // The refresh token family the token was issued for
+	Version   int64  `json:"ver"` // The user's token version when issued
 	jwt.RegisteredClaims
 }
 
@@ -34,13 +46,15 @@ func AuthMiddleware(config JWTConfig) echo.MiddlewareFunc {
 			}
 
 			tokenString := parts[1]
-
-			token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			if strings.HasPrefix(tokenString, APIKeyPrefix) {
+				if err := authenticateAPIKey(c, config, tokenString); err != nil {
+					return err
 				}
-				return []byte(config.SecretKey), nil
-			})
+				return next(c)
+			}
+
+			token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, config.Keys.Keyfunc,
+				jwt.WithValidMethods(config.Keys.Methods()))
 
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
@@ -51,24 +65,35 @@ func AuthMiddleware(config JWTConfig) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token claims")
 			}
 
+			revoked, err := config.Store.IsTokenRevoked(c.Request().Context(), claims.UserID, claims.ID, claims.SessionID, claims.Version)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check token")
+			}
+			if revoked {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token revoked")
+			}
+
 			c.Set("user_id", claims.UserID)
 			c.Set("username", claims.Username)
+			c.Set("claims", claims)
 
 			return next(c)
 		}
 	}
 }
 
-func GenerateToken(userID, username string, secretKey string) (string, error) {
+func GenerateToken(userID, username, sessionID string, version int64, keyRing *keys.Ring) (string, error) {
 	claims := &JWTClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
+		Version:   version,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return keyRing.Sign(claims)
 }
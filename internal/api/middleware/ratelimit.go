@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/ratelimit"
+)
+
+// KeyFunc picks the subject a request is rate limited as.
+type KeyFunc func(c echo.Context) string
+
+func ByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// ByUser limits authenticated users by ID and anyone else by IP.
+func ByUser(c echo.Context) string {
+	if userID, ok := c.Get("user_id").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return ByIP(c)
+}
+
+// RateLimit rejects requests over limit with 429 and a Retry-After header,
+// and reports the remaining budget in X-RateLimit-* headers. If Redis is
+// unavailable requests are let through.
+func RateLimit(limiter *ratelimit.Limiter, limit ratelimit.Limit, key KeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res, err := limiter.Allow(c.Request().Context(), limit, key(c))
+			if err != nil {
+				log.Printf("rate limiting failed, allowing request: %v", err)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("X-RateLimit-Reset", strconv.Itoa(ratelimit.Seconds(res.ResetAfter)))
+
+			if !res.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ratelimit.Seconds(res.RetryAfter)))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
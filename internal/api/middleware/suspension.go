@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// RejectSuspended blocks suspended users. It must run after AuthMiddleware.
+func RejectSuspended(s *store.RedisStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			suspension, err := s.GetSuspension(c.Request().Context(), c.Get("user_id").(string))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check account status")
+			}
+			if suspension != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "account suspended")
+			}
+			return next(c)
+		}
+	}
+}
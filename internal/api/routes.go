@@ -8,6 +8,15 @@ import (
 
 	"github.com/bm-197/go-chat/internal/api/handlers"
 	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/auth"
+	"github.com/bm-197/go-chat/internal/keys"
+	"github.com/bm-197/go-chat/internal/mail"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/oidc"
+	"github.com/bm-197/go-chat/internal/password"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/ratelimit"
+	"github.com/bm-197/go-chat/internal/service"
 	"github.com/bm-197/go-chat/internal/store"
 )
 
@@ -19,43 +28,143 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
 
-func RegisterHandlers(e *echo.Echo, store *store.RedisStore) {
+func RegisterHandlers(e *echo.Echo, store *store.RedisStore, messageService *service.MessageService, plugins *plugin.Registry, keyRing *keys.Ring, providers *oidc.Providers, passwords *password.Manager, mailer mail.Mailer, appURL string) {
 	e.Validator = &CustomValidator{validator: validator.New()}
 
-	userHandler := handlers.NewUserHandler(store, os.Getenv("JWT_SECRET"))
+	issuer := auth.NewIssuer(store, keyRing)
+	guard := auth.NewLoginGuard(store)
+	userHandler := handlers.NewUserHandler(store, issuer, guard, passwords)
+	accountHandler := handlers.NewAccountHandler(store, issuer, passwords, mailer, appURL)
+	oidcHandler := handlers.NewOIDCHandler(store, issuer, providers)
+	mfaHandler := handlers.NewMFAHandler(store, guard)
 	groupHandler := handlers.NewGroupHandler(store)
-	messageHandler := handlers.NewMessageHandler(store)
-	wsHandler := handlers.NewWebSocketHandler(store)
+	messageHandler := handlers.NewMessageHandler(store, messageService)
+	pinHandler := handlers.NewPinHandler(store)
+	pollHandler := handlers.NewPollHandler(store, messageService)
+	starHandler := handlers.NewStarHandler(store)
+	searchHandler := handlers.NewSearchHandler(store)
+	moderationHandler := handlers.NewModerationHandler(store)
+	reportHandler := handlers.NewReportHandler(store)
+	auditHandler := handlers.NewAuditHandler(store)
+	keysHandler := handlers.NewKeysHandler(keyRing)
+	botHandler := handlers.NewBotHandler(store)
+	sessionHandler := handlers.NewSessionHandler(store, issuer)
+	limiter := ratelimit.NewLimiter(store)
+	wsHandler := handlers.NewWebSocketHandler(store, messageService, plugins, limiter)
 
+	// Filled in below as routes that bots may use are registered
+	apiKeyScopes := middleware.APIKeyScopes{}
 	jwtMiddleware := middleware.AuthMiddleware(middleware.JWTConfig{
-		SecretKey: os.Getenv("JWT_SECRET"),
+		Keys:         keyRing,
+		Store:        store,
+		APIKeyScopes: apiKeyScopes,
 	})
+	authLimit := middleware.RateLimit(limiter, ratelimit.Auth, middleware.ByIP)
+	sendLimit := middleware.RateLimit(limiter, ratelimit.Send, middleware.ByUser)
+	historyLimit := middleware.RateLimit(limiter, ratelimit.History, middleware.ByUser)
+	adminMiddleware := middleware.AdminOnly(middleware.ParseAdminIDs(os.Getenv("ADMIN_USER_IDS")))
 
 	// Public routes
-	e.POST("/api/register", userHandler.Register)
-	e.POST("/api/login", userHandler.Login)
+	e.GET("/.well-known/jwks.json", keysHandler.GetJWKS)
+	e.POST("/api/register", userHandler.Register, authLimit)
+	e.POST("/api/login", userHandler.Login, authLimit)
+	e.POST("/api/login/mfa", userHandler.LoginMFA, authLimit)
+	e.POST("/api/token/refresh", userHandler.RefreshToken, authLimit)
+	e.POST("/api/email/verify", accountHandler.VerifyEmail, authLimit)
+	e.POST("/api/password/reset", accountHandler.RequestPasswordReset, authLimit)
+	e.POST("/api/password/reset/confirm", accountHandler.ConfirmPasswordReset, authLimit)
+	e.GET("/api/auth/oidc/providers", oidcHandler.ListProviders)
+	e.GET("/api/auth/oidc/:provider/login", oidcHandler.Login, authLimit)
+	e.GET("/api/auth/oidc/:provider/callback", oidcHandler.Callback, authLimit)
 
 	// Protected routes
-	api := e.Group("/api", jwtMiddleware)
+	api := e.Group("/api", jwtMiddleware, middleware.RejectSuspended(store))
 
 	// User routes
 	api.GET("/profile", userHandler.GetProfile)
+	api.POST("/profile/password", userHandler.ChangePassword, authLimit)
+	api.PUT("/profile/email", accountHandler.ChangeEmail, authLimit)
+	api.POST("/logout", userHandler.Logout)
+	api.POST("/logout/all", userHandler.LogoutEverywhere)
+	api.GET("/sessions", sessionHandler.ListSessions)
+	api.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+	api.POST("/auth/oidc/:provider/link", oidcHandler.Link, authLimit)
+	api.GET("/2fa", mfaHandler.GetStatus)
+	api.POST("/2fa/totp", mfaHandler.EnrollTOTP)
+	api.POST("/2fa/totp/confirm", mfaHandler.ConfirmTOTP, authLimit)
+	api.POST("/2fa/totp/disable", mfaHandler.DisableTOTP, authLimit)
+	api.POST("/2fa/recovery-codes", mfaHandler.RegenerateRecoveryCodes, authLimit)
+	api.GET("/identities", oidcHandler.ListIdentities)
+	api.DELETE("/identities/:provider", oidcHandler.Unlink)
+
+	// Bot routes, for the bots' owners
+	api.POST("/bots", botHandler.CreateBot)
+	api.GET("/bots", botHandler.ListBots)
+	api.DELETE("/bots/:id", botHandler.DeleteBot)
+	api.POST("/bots/:id/keys", botHandler.CreateAPIKey)
+	api.GET("/bots/:id/keys", botHandler.ListAPIKeys)
+	api.DELETE("/bots/:id/keys/:keyID", botHandler.RevokeAPIKey)
 
 	// Group routes
 	api.POST("/groups", groupHandler.CreateGroup)
-	api.GET("/groups", groupHandler.ListGroups)
-	api.GET("/groups/:id", groupHandler.GetGroup)
-	api.POST("/groups/:id/join", groupHandler.JoinGroup)
-	api.POST("/groups/:id/leave", groupHandler.LeaveGroup)
+	apiKeyScopes.Allow(api.GET("/groups", groupHandler.ListGroups), models.ScopeGroupsRead)
+	apiKeyScopes.Allow(api.GET("/groups/:id", groupHandler.GetGroup), models.ScopeGroupsRead)
+	apiKeyScopes.Allow(api.POST("/groups/:id/join", groupHandler.JoinGroup), models.ScopeGroupsWrite)
+	apiKeyScopes.Allow(api.POST("/groups/:id/leave", groupHandler.LeaveGroup), models.ScopeGroupsWrite)
 	api.DELETE("/groups/:id/members/:memberID", groupHandler.RemoveMember)
 	api.DELETE("/groups/:id", groupHandler.DeleteGroup)
+	api.GET("/groups/:id/ttl", groupHandler.GetMessageTTL)
+	api.PUT("/groups/:id/ttl", groupHandler.SetMessageTTL)
+	apiKeyScopes.Allow(api.POST("/groups/:id/polls", pollHandler.CreatePoll, sendLimit), models.ScopeMessagesWrite)
+	apiKeyScopes.Allow(api.GET("/groups/:id/pins", pinHandler.GetGroupPins, historyLimit), models.ScopeMessagesRead)
+	api.POST("/groups/:id/pins/:messageID", pinHandler.PinGroupMessage)
+	api.DELETE("/groups/:id/pins/:messageID", pinHandler.UnpinGroupMessage)
+	api.GET("/groups/:id/moderation/rules", moderationHandler.GetGroupRules)
+	api.PUT("/groups/:id/moderation/rules", moderationHandler.SetGroupRules)
 
 	// Message routes
-	api.POST("/messages", messageHandler.SendMessage)
-	api.GET("/messages/private/:userID", messageHandler.GetPrivateMessages)
-	api.GET("/messages/group/:groupID", messageHandler.GetGroupMessages)
-	api.GET("/messages/broadcast", messageHandler.GetBroadcastMessages)
+	apiKeyScopes.Allow(api.POST("/messages", messageHandler.SendMessage, sendLimit), models.ScopeMessagesWrite)
+	apiKeyScopes.Allow(api.POST("/messages/:id/forward", messageHandler.ForwardMessage, sendLimit), models.ScopeMessagesWrite)
+	apiKeyScopes.Allow(api.GET("/messages/scheduled", messageHandler.GetScheduledMessages), models.ScopeMessagesRead)
+	apiKeyScopes.Allow(api.DELETE("/messages/scheduled/:id", messageHandler.CancelScheduledMessage), models.ScopeMessagesWrite)
+	apiKeyScopes.Allow(api.GET("/messages/private/:userID", messageHandler.GetPrivateMessages, historyLimit), models.ScopeMessagesRead)
+	apiKeyScopes.Allow(api.GET("/messages/private/:userID/around", messageHandler.GetPrivateMessagesAround, historyLimit), models.ScopeMessagesRead)
+	api.GET("/messages/private/:userID/ttl", messageHandler.GetPrivateMessageTTL)
+	api.PUT("/messages/private/:userID/ttl", messageHandler.SetPrivateMessageTTL)
+	api.GET("/messages/private/:userID/pins", pinHandler.GetPrivatePins, historyLimit)
+	api.POST("/messages/private/:userID/pins/:messageID", pinHandler.PinPrivateMessage)
+	api.DELETE("/messages/private/:userID/pins/:messageID", pinHandler.UnpinPrivateMessage)
+	apiKeyScopes.Allow(api.GET("/messages/group/:groupID", messageHandler.GetGroupMessages, historyLimit), models.ScopeMessagesRead)
+	apiKeyScopes.Allow(api.GET("/messages/group/:groupID/around", messageHandler.GetGroupMessagesAround, historyLimit), models.ScopeMessagesRead)
+	apiKeyScopes.Allow(api.GET("/messages/broadcast", messageHandler.GetBroadcastMessages, historyLimit), models.ScopeMessagesRead)
+	apiKeyScopes.Allow(api.GET("/messages/broadcast/around", messageHandler.GetBroadcastMessagesAround, historyLimit), models.ScopeMessagesRead)
+
+	// Poll routes
+	apiKeyScopes.Allow(api.POST("/polls/:messageID/votes", pollHandler.Vote, sendLimit), models.ScopeMessagesWrite)
+
+	// Search route
+	apiKeyScopes.Allow(api.GET("/search", searchHandler.Search, historyLimit), models.ScopeMessagesRead)
+
+	// Star routes
+	api.GET("/stars", starHandler.ListStars, historyLimit)
+	api.POST("/stars/:messageID", starHandler.StarMessage)
+	api.DELETE("/stars/:messageID", starHandler.UnstarMessage)
+
+	// Report route
+	api.POST("/reports", reportHandler.CreateReport)
+
+	// Moderation routes
+	admin := api.Group("/moderation", adminMiddleware)
+	admin.GET("/rules", moderationHandler.GetGlobalRules)
+	admin.PUT("/rules", moderationHandler.SetGlobalRules)
+	admin.GET("/flags", moderationHandler.ListFlags)
+	admin.GET("/reports", reportHandler.ListReports)
+	admin.GET("/reports/:id", reportHandler.GetReport)
+	admin.POST("/reports/:id/resolve", reportHandler.ResolveReport)
+	admin.DELETE("/users/:id/suspension", reportHandler.LiftSuspension)
+	admin.GET("/audit", auditHandler.ListAuditEvents)
+	admin.PUT("/bots/:id/permissions", botHandler.SetBotPermissions)
 
 	// WebSocket route
-	api.GET("/ws", wsHandler.HandleWebSocket)
+	apiKeyScopes.Allow(api.GET("/ws", wsHandler.HandleWebSocket), models.ScopeMessagesRead)
 }
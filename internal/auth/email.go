@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	// VerifyEmailTTL is how long an email verification link works.
+	VerifyEmailTTL = 24 * time.Hour
+	// PasswordResetTTL is how long a password reset link works.
+	PasswordResetTTL = time.Hour
+)
+
+// EmailToken creates a single-use token to send to the user by email. A new
+// token replaces the user's previous one for the same purpose.
+func (i *Issuer) EmailToken(ctx context.Context, purpose models.EmailTokenPurpose, userID, email string) (string, error) {
+	ttl := VerifyEmailTTL
+	if purpose == models.EmailTokenPasswordReset {
+		ttl = PasswordResetTTL
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	emailToken := &models.EmailToken{
+		Purpose: purpose,
+		UserID:  userID,
+		Email:   email,
+	}
+	if err := i.store.SaveEmailToken(ctx, hashToken(token), emailToken, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RedeemEmailToken uses up a token made by EmailToken. Tokens made for
+// another purpose are rejected, and used up too.
+func (i *Issuer) RedeemEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, token string) (*models.EmailToken, error) {
+	emailToken, err := i.store.TakeEmailToken(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if emailToken.Purpose != purpose {
+		return nil, store.ErrEmailTokenInvalid
+	}
+	return emailToken, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+var (
+	// usernameLockout protects single accounts from password guessing.
+	usernameLockout = store.LoginLockoutPolicy{
+		FreeAttempts: 5,
+		BaseDelay:    5 * time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+	// ipLockout slows down credential stuffing across many accounts from
+	// one address.
+	ipLockout = store.LoginLockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    5 * time.Second,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// LoginGuard tracks failed logins per username and per IP, locking each out
+// for longer with every failure past a few free attempts. Usernames are
+// tracked whether or not they exist, so lockouts don't reveal which do.
+type LoginGuard struct {
+	store *store.RedisStore
+}
+
+func NewLoginGuard(store *store.RedisStore) *LoginGuard {
+	return &LoginGuard{
+		store: store,
+	}
+}
+
+// Check returns how long logins for username from ip are locked out, or 0
+// if they aren't.
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	return g.store.GetLoginLockout(ctx, usernameSubject(username), ipSubject(ip))
+}
+
+// Failed records a failed login and returns the lockout it caused, if any.
+func (g *LoginGuard) Failed(ctx context.Context, username, ip string) (time.Duration, error) {
+	_, userLockout, err := g.store.RecordLoginFailure(ctx, usernameSubject(username), usernameLockout)
+	if err != nil {
+		return 0, err
+	}
+	_, addrLockout, err := g.store.RecordLoginFailure(ctx, ipSubject(ip), ipLockout)
+	if err != nil {
+		return 0, err
+	}
+	return max(userLockout, addrLockout), nil
+}
+
+// Succeeded forgets the failed logins for username. The IP's failures are
+// kept, so one valid account doesn't reset an attack on others.
+func (g *LoginGuard) Succeeded(ctx context.Context, username string) error {
+	return g.store.ClearLoginFailures(ctx, usernameSubject(username))
+}
+
+func usernameSubject(username string) string {
+	return "user:" + username
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginGuard(t *testing.T) {
+	guard := NewLoginGuard(newTestStore(t))
+	ctx := context.Background()
+
+	for i := 0; i < usernameLockout.FreeAttempts; i++ {
+		lockout, err := guard.Failed(ctx, "alice", "10.0.0.1")
+		if err != nil || lockout != 0 {
+			t.Fatalf("failure %d = %v, %v; want no lockout", i+1, lockout, err)
+		}
+	}
+
+	lockout, err := guard.Failed(ctx, "alice", "10.0.0.1")
+	if err != nil || lockout != usernameLockout.BaseDelay {
+		t.Fatalf("failure past the free attempts = %v, %v; want %v", lockout, err, usernameLockout.BaseDelay)
+	}
+	lockout, err = guard.Failed(ctx, "alice", "10.0.0.1")
+	if err != nil || lockout != 2*usernameLockout.BaseDelay {
+		t.Fatalf("next failure = %v, %v; want %v", lockout, err, 2*usernameLockout.BaseDelay)
+	}
+
+	if lockout, _ := guard.Check(ctx, "alice", "10.0.0.2"); lockout <= 0 {
+		t.Errorf("username isn't locked out from another IP")
+	}
+	if lockout, _ := guard.Check(ctx, "bob", "10.0.0.1"); lockout != 0 {
+		t.Errorf("IP is locked out for other users after %d failures: %v", usernameLockout.FreeAttempts+2, lockout)
+	}
+
+	if err := guard.Succeeded(ctx, "alice"); err != nil {
+		t.Fatalf("Succeeded() error = %v", err)
+	}
+	if lockout, _ := guard.Check(ctx, "alice", "10.0.0.1"); lockout != 0 {
+		t.Errorf("Check() after success = %v, want no lockout", lockout)
+	}
+}
+
+func TestLoginGuardLocksOutIPs(t *testing.T) {
+	guard := NewLoginGuard(newTestStore(t))
+	ctx := context.Background()
+
+	// Spread over many usernames, only the IP's budget runs out.
+	var lockout time.Duration
+	for i := 0; i <= ipLockout.FreeAttempts; i++ {
+		var err error
+		if lockout, err = guard.Failed(ctx, fmt.Sprintf("user%d", i), "10.0.0.1"); err != nil {
+			t.Fatalf("Failed() error = %v", err)
+		}
+	}
+	if lockout != ipLockout.BaseDelay {
+		t.Fatalf("lockout = %v, want %v", lockout, ipLockout.BaseDelay)
+	}
+
+	if err := guard.Succeeded(ctx, "user0"); err != nil {
+		t.Fatalf("Succeeded() error = %v", err)
+	}
+	if lockout, _ := guard.Check(ctx, "someone", "10.0.0.1"); lockout <= 0 {
+		t.Errorf("a successful login cleared the IP's lockout")
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	// ChallengeTTL is how long a user has to enter their second factor
+	// after their password.
+	ChallengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid or expired challenge")
+	ErrInvalidCode      = errors.New("invalid code")
+	ErrAccountSuspended = errors.New("account suspended")
+)
+
+// Challenge starts the second step of a login for a user with two-factor
+// authentication. The returned token stands in for the password in
+// CompleteChallenge.
+func (i *Issuer) Challenge(ctx context.Context, user *models.User) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := i.store.SaveMFAChallenge(ctx, hashToken(token), user.ID, ChallengeTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ChallengeUser returns the user a challenge token belongs to, so callers
+// can apply the user's login lockout before CompleteChallenge.
+func (i *Issuer) ChallengeUser(ctx context.Context, challengeToken string) (*models.User, error) {
+	userID, err := i.store.GetMFAChallengeUser(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, store.ErrMFAChallengeInvalid) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	user, err := i.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	return user, nil
+}
+
+// CompleteChallenge exchanges a challenge token and a TOTP or recovery code
+// for a token pair for a session on device. A challenge allows a few wrong
+// codes before it has to be started over.
+func (i *Issuer) CompleteChallenge(ctx context.Context, challengeToken, code string, device Device) (*TokenPair, error) {
+	challengeHash := hashToken(challengeToken)
+	userID, attempts, err := i.store.AttemptMFAChallenge(ctx, challengeHash)
+	if err != nil {
+		if errors.Is(err, store.ErrMFAChallengeInvalid) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if attempts > maxChallengeAttempts {
+		if err := i.store.DeleteMFAChallenge(ctx, challengeHash); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := VerifySecondFactor(ctx, i.store, userID, code); err != nil {
+		return nil, err
+	}
+	if err := i.store.DeleteMFAChallenge(ctx, challengeHash); err != nil {
+		return nil, err
+	}
+
+	user, err := i.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	// The user may have been suspended since entering their password.
+	suspension, err := i.store.GetSuspension(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if suspension != nil {
+		return nil, ErrAccountSuspended
+	}
+	return i.Issue(ctx, user, device)
+}
+
+// VerifySecondFactor checks a TOTP code, or uses up a recovery code, for a
+// user with two-factor authentication enabled. TOTP codes can't be reused.
+func VerifySecondFactor(ctx context.Context, s *store.RedisStore, userID, code string) error {
+	config, err := s.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if config == nil || !config.Enabled {
+		return ErrInvalidCode
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := ValidateTOTP(config.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+		fresh, err := s.UseTOTPStep(ctx, userID, step, TOTPReplayWindow)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	valid, err := s.UseRecoveryCode(ctx, userID, HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidCode
+	}
+	return nil
+}
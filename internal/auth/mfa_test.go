@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.RedisStore {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(mr.Host(), mr.Port())
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if err := VerifySecondFactor(ctx, s, "u1", "123456"); err != ErrInvalidCode {
+		t.Errorf("without two-factor authentication error = %v, want %v", err, ErrInvalidCode)
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("NewTOTPSecret() error = %v", err)
+	}
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes() error = %v", err)
+	}
+	config := &models.TOTPConfig{Secret: secret, Enabled: true, CreatedAt: time.Now()}
+	if err := s.SaveTOTP(ctx, "u1", config, hashes); err != nil {
+		t.Fatalf("SaveTOTP() error = %v", err)
+	}
+
+	key, _ := base32NoPadding.DecodeString(secret)
+	code := totpCode(key, time.Now().Unix()/int64(totpPeriod.Seconds()))
+	if err := VerifySecondFactor(ctx, s, "u1", code); err != nil {
+		t.Fatalf("current TOTP code error = %v", err)
+	}
+	if err := VerifySecondFactor(ctx, s, "u1", code); err != ErrInvalidCode {
+		t.Errorf("replayed TOTP code error = %v, want %v", err, ErrInvalidCode)
+	}
+
+	if err := VerifySecondFactor(ctx, s, "u1", codes[0]); err != nil {
+		t.Fatalf("recovery code error = %v", err)
+	}
+	if err := VerifySecondFactor(ctx, s, "u1", codes[0]); err != ErrInvalidCode {
+		t.Errorf("reused recovery code error = %v, want %v", err, ErrInvalidCode)
+	}
+	if err := VerifySecondFactor(ctx, s, "u1", "nope-nope"); err != ErrInvalidCode {
+		t.Errorf("unknown recovery code error = %v, want %v", err, ErrInvalidCode)
+	}
+}
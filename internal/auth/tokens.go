@@ -0,0 +1,197 @@
+// Package auth issues the tokens clients authenticate with: short-lived JWT
+// access tokens and opaque, rotating refresh tokens kept in Redis.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/keys"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// RefreshTokenTTL is how long a refresh token stays valid if unused. Every
+// refresh issues a new one, so active sessions never expire.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// TokenPair is returned on login and refresh. The refresh token is only ever
+// shown here; the server keeps its hash.
+type TokenPair struct {
+	User         *models.User
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int // Access token lifetime in seconds
+}
+
+// Device describes the client a session is used from.
+type Device struct {
+	Name      string // Chosen by the user; guessed from UserAgent if empty
+	UserAgent string
+	IP        string
+}
+
+type Issuer struct {
+	store   *store.RedisStore
+	keyRing *keys.Ring
+}
+
+func NewIssuer(store *store.RedisStore, keyRing *keys.Ring) *Issuer {
+	return &Issuer{
+		store:   store,
+		keyRing: keyRing,
+	}
+}
+
+// Issue starts a new session for user on device, with a new refresh token
+// family.
+func (i *Issuer) Issue(ctx context.Context, user *models.User, device Device) (*TokenPair, error) {
+	familyID := uuid.New().String()
+	tokens, err := i.issue(ctx, user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := device.Name
+	if name == "" {
+		name = DeviceName(device.UserAgent)
+	}
+	session := models.NewSession(familyID, user.ID, name, device.UserAgent, device.IP)
+	if err := i.store.SaveSession(ctx, session, RefreshTokenTTL); err != nil {
+		// A family without a session can't be listed or revoked by the
+		// user, so the tokens are withdrawn.
+		if err := i.RevokeSession(ctx, user.ID, familyID); err != nil {
+			log.Printf("failed to revoke session %s: %v", familyID, err)
+		}
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair in the same family,
+// recording the session as active on device. Presenting an already rotated
+// token revokes the family, logging out whoever holds the current token.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string, device Device) (*TokenPair, error) {
+	family, err := i.store.RotateRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, store.ErrRefreshTokenReused) {
+			log.Printf("refresh token reuse for user %s, revoked token family %s", family.UserID, family.FamilyID)
+			// Also cut off the access token and sockets of the family.
+			if err := i.store.RevokeSession(ctx, family.UserID, family.FamilyID, middleware.AccessTokenTTL); err != nil {
+				log.Printf("failed to revoke session %s: %v", family.FamilyID, err)
+			}
+			if err := i.store.DeleteSession(ctx, family.UserID, family.FamilyID); err != nil {
+				log.Printf("failed to delete session %s: %v", family.FamilyID, err)
+			}
+			return nil, ErrInvalidRefreshToken
+		}
+		if errors.Is(err, store.ErrRefreshTokenInvalid) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	user, err := i.store.GetUserByID(ctx, family.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	version, err := i.store.GetTokenVersion(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	suspension, err := i.store.GetSuspension(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if suspension != nil || family.Version < version {
+		if err := i.store.RevokeRefreshFamily(ctx, family.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := i.issue(ctx, user, family.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	// Families from before sessions were recorded have none.
+	if err := i.store.TouchSession(ctx, family.FamilyID, device.IP, device.UserAgent, RefreshTokenTTL); err != nil && !errors.Is(err, store.ErrSessionNotFound) {
+		log.Printf("failed to update session %s: %v", family.FamilyID, err)
+	}
+	return tokens, nil
+}
+
+// Logout revokes the session an access token belongs to, including access
+// tokens issued for it before the last refresh.
+func (i *Issuer) Logout(ctx context.Context, claims *middleware.JWTClaims) error {
+	return i.RevokeSession(ctx, claims.UserID, claims.SessionID)
+}
+
+// RevokeSession logs a user out of one session: its refresh tokens, its
+// access tokens and the WebSockets opened with them.
+func (i *Issuer) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := i.store.RevokeRefreshFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	if err := i.store.DeleteSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return i.store.RevokeSession(ctx, userID, sessionID, middleware.AccessTokenTTL)
+}
+
+// LogoutEverywhere revokes every token issued to the user so far.
+func (i *Issuer) LogoutEverywhere(ctx context.Context, userID string) error {
+	return i.store.RevokeUserTokens(ctx, userID)
+}
+
+func (i *Issuer) issue(ctx context.Context, user *models.User, familyID string) (*TokenPair, error) {
+	version, err := i.store.GetTokenVersion(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := middleware.GenerateToken(user.ID, user.Username, familyID, version, i.keyRing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	if err := i.store.SaveRefreshToken(ctx, hashToken(refreshToken), user.ID, familyID, version, RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
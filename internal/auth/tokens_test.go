@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bm-197/go-chat/internal/api/middleware"
+	"github.com/bm-197/go-chat/internal/keys"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+func newTestIssuer(t *testing.T) (*Issuer, *store.RedisStore, *keys.Ring, *models.User) {
+	t.Helper()
+
+	s := newTestStore(t)
+	ring, err := keys.NewRing(s, keys.Config{Algorithm: keys.AlgHS256, HMACSecret: "secret"})
+	if err != nil {
+		t.Fatalf("NewRing() error = %v", err)
+	}
+	user := models.NewUser("alice", "hash")
+	if err := s.SaveUser(context.Background(), user); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	return NewIssuer(s, ring), s, ring, user
+}
+
+// accessTokenRevoked parses an access token and checks it the way the auth
+// middleware does.
+func accessTokenRevoked(t *testing.T, s *store.RedisStore, ring *keys.Ring, token string) (*middleware.JWTClaims, bool) {
+	t.Helper()
+
+	claims := &middleware.JWTClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, ring.Keyfunc, jwt.WithValidMethods(ring.Methods())); err != nil {
+		t.Fatalf("ParseWithClaims() error = %v", err)
+	}
+	revoked, err := s.IsTokenRevoked(context.Background(), claims.UserID, claims.ID, claims.SessionID, claims.Version)
+	if err != nil {
+		t.Fatalf("IsTokenRevoked() error = %v", err)
+	}
+	return claims, revoked
+}
+
+func TestRefreshRotates(t *testing.T) {
+	issuer, s, ring, user := newTestIssuer(t)
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, user, Device{UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	second, err := issuer.Refresh(ctx, first.RefreshToken, Device{})
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Errorf("Refresh() returned the same refresh token")
+	}
+
+	firstClaims, _ := accessTokenRevoked(t, s, ring, first.AccessToken)
+	secondClaims, revoked := accessTokenRevoked(t, s, ring, second.AccessToken)
+	if revoked || secondClaims.SessionID != firstClaims.SessionID {
+		t.Errorf("refreshed access token revoked = %v, session = %s; want a valid token of session %s",
+			revoked, secondClaims.SessionID, firstClaims.SessionID)
+	}
+
+	if _, err := issuer.Refresh(ctx, "unknown", Device{}); err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh(unknown) error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	issuer, s, ring, user := newTestIssuer(t)
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	second, err := issuer.Refresh(ctx, first.RefreshToken, Device{})
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	other, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	// Replaying a rotated token means it leaked: the family is revoked,
+	// including the refresh and access tokens its rightful holder has now.
+	if _, err := issuer.Refresh(ctx, first.RefreshToken, Device{}); err != ErrInvalidRefreshToken {
+		t.Fatalf("Refresh(reused) error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, err := issuer.Refresh(ctx, second.RefreshToken, Device{}); err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh(current token of a revoked family) error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, revoked := accessTokenRevoked(t, s, ring, second.AccessToken); !revoked {
+		t.Errorf("access token of the revoked family still valid")
+	}
+	sessions, err := s.GetUserSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("GetUserSessions() = %d sessions, %v; want only the other session", len(sessions), err)
+	}
+
+	// Other sessions are unaffected.
+	if _, revoked := accessTokenRevoked(t, s, ring, other.AccessToken); revoked {
+		t.Errorf("access token of another session revoked")
+	}
+	if _, err := issuer.Refresh(ctx, other.RefreshToken, Device{}); err != nil {
+		t.Errorf("Refresh() of another session error = %v", err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	issuer, s, ring, user := newTestIssuer(t)
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	second, err := issuer.Refresh(ctx, first.RefreshToken, Device{})
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	other, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	claims, _ := accessTokenRevoked(t, s, ring, second.AccessToken)
+	if err := issuer.Logout(ctx, claims); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+
+	// Access tokens issued before the last refresh go too.
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, revoked := accessTokenRevoked(t, s, ring, token); !revoked {
+			t.Errorf("access token of the logged out session still valid")
+		}
+	}
+	if _, err := issuer.Refresh(ctx, second.RefreshToken, Device{}); err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh() after logout error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, revoked := accessTokenRevoked(t, s, ring, other.AccessToken); revoked {
+		t.Errorf("access token of another session revoked")
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	issuer, s, ring, user := newTestIssuer(t)
+	ctx := context.Background()
+
+	before, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if err := issuer.LogoutEverywhere(ctx, user.ID); err != nil {
+		t.Fatalf("LogoutEverywhere() error = %v", err)
+	}
+
+	if _, revoked := accessTokenRevoked(t, s, ring, before.AccessToken); !revoked {
+		t.Errorf("access token issued before LogoutEverywhere still valid")
+	}
+	if _, err := issuer.Refresh(ctx, before.RefreshToken, Device{}); err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh() after LogoutEverywhere error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	after, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if _, revoked := accessTokenRevoked(t, s, ring, after.AccessToken); revoked {
+		t.Errorf("access token issued after LogoutEverywhere revoked")
+	}
+	if _, err := issuer.Refresh(ctx, after.RefreshToken, Device{}); err != nil {
+		t.Errorf("Refresh() of a new session error = %v", err)
+	}
+}
+
+func TestRefreshRejectsSuspendedUsers(t *testing.T) {
+	issuer, s, _, user := newTestIssuer(t)
+	ctx := context.Background()
+
+	tokens, err := issuer.Issue(ctx, user, Device{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if err := s.SuspendUser(ctx, &models.Suspension{UserID: user.ID}); err != nil {
+		t.Fatalf("SuspendUser() error = %v", err)
+	}
+	if _, err := issuer.Refresh(ctx, tokens.RefreshToken, Device{}); err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh() while suspended error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name string
+		now  int64
+		code string
+		ok   bool
+	}{
+		// RFC 6238 appendix B, truncated to six digits.
+		{"vector 59", 59, "287082", true},
+		{"vector 1111111109", 1111111109, "081804", true},
+		{"vector 1234567890", 1234567890, "005924", true},
+		{"lowercase secret", 59, "287082", true},
+		{"previous step", 59 + 30, "287082", true},
+		{"two steps ago", 59 + 60, "287082", false},
+		{"wrong code", 59, "287083", false},
+		{"too short", 59, "28708", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := rfcSecret
+			if tt.name == "lowercase secret" {
+				secret = strings.ToLower(secret)
+			}
+			_, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.ok {
+				t.Errorf("ValidateTOTP(%q at %d) = %v, want %v", tt.code, tt.now, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPReturnsStep(t *testing.T) {
+	step, ok := ValidateTOTP(rfcSecret, "287082", time.Unix(59+30, 0))
+	if !ok || step != 1 {
+		t.Errorf("ValidateTOTP() = %d, %v; want step 1", step, ok)
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("NewTOTPSecret() error = %v", err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != totpSecretBytes {
+		t.Errorf("secret %q decodes to %d bytes, %v; want %d", secret, len(key), err, totpSecretBytes)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/int64(totpPeriod.Seconds()))
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("current code %s for a new secret is rejected", code)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("go-chat", "alice smith", rfcSecret))
+	if err != nil {
+		t.Fatalf("invalid URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/go-chat:alice smith" {
+		t.Errorf("URI = %s, want otpauth://totp/go-chat:alice%%20smith", uri)
+	}
+	if got := uri.Query().Get("secret"); got != rfcSecret {
+		t.Errorf("secret = %q, want %q", got, rfcSecret)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate recovery code %s", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("code %s typed as %q doesn't match its hash", code, typed)
+		}
+	}
+}
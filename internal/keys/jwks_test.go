@@ -0,0 +1,65 @@
+package keys
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			signingKey, err := generateKey(alg)
+			if err != nil {
+				t.Fatalf("generateKey() error = %v", err)
+			}
+			k, err := parseKey(signingKey)
+			if err != nil {
+				t.Fatalf("parseKey() error = %v", err)
+			}
+
+			jwk, ok := NewJWK(k.ID, k.Algorithm, k.signer.Public())
+			if !ok {
+				t.Fatalf("NewJWK() can't describe a %s key", alg)
+			}
+			public, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey() error = %v", err)
+			}
+			type equaler interface {
+				Equal(crypto.PublicKey) bool
+			}
+			if !k.signer.Public().(equaler).Equal(public) {
+				t.Errorf("PublicKey() doesn't match the original key")
+			}
+		})
+	}
+}
+
+func TestJWKRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unknown type", JWK{KeyType: "oct"}},
+		{"RSA without a modulus", JWK{KeyType: "RSA", E: "AQAB"}},
+		{"EC point off the curve", JWK{KeyType: "EC", Curve: "P-256", X: "AQ", Y: "AQ"}},
+		{"unknown curve", JWK{KeyType: "EC", Curve: "secp256k1", X: "AQ", Y: "AQ"}},
+		{"short Ed25519 key", JWK{KeyType: "OKP", Curve: "Ed25519", X: "AQ"}},
+		{"bad base64", JWK{KeyType: "OKP", Curve: "Ed25519", X: "!!"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.jwk.PublicKey(); err == nil {
+				t.Errorf("PublicKey() accepted %+v", tt.jwk)
+			}
+		})
+	}
+}
+
+func TestJWKSEmptyForHS256(t *testing.T) {
+	ring := newTestRing(t, newTestStore(t), AlgHS256)
+	if jwks := ring.JWKS(); jwks.Keys == nil || len(jwks.Keys) != 0 {
+		t.Errorf("JWKS() = %+v, want an empty key list", jwks)
+	}
+}
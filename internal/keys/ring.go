@@ -0,0 +1,374 @@
+// Package keys manages the keys access tokens are signed with.
+//
+// With HS256 every node shares JWT_SECRET. With RS256, ES256 or EdDSA the
+// private keys live in Redis, so all nodes sign and verify with the same set,
+// and their public halves are published as a JWKS for other services. Keys
+// rotate on a schedule: the next key is generated and published an hour
+// before it starts signing, and a retired key keeps verifying tokens for a
+// grace period.
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	// prepublish is how long before it signs a key appears in the JWKS, so
+	// verifiers that cache it pick it up in time.
+	prepublish = time.Hour
+
+	refreshInterval = 30 * time.Second
+	// minMissRefresh limits reloads caused by tokens with unknown key IDs.
+	minMissRefresh  = 5 * time.Second
+	rotationLockTTL = 30 * time.Second
+	rsaKeyBits      = 2048
+)
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+type Config struct {
+	Algorithm  string
+	HMACSecret string        // HS256 only
+	Rotation   time.Duration // How long each key signs
+	Grace      time.Duration // How long a retired key still verifies; longer than tokens live
+}
+
+// key is a parsed SigningKey.
+type key struct {
+	*models.SigningKey
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+type Ring struct {
+	store  *store.RedisStore
+	config Config
+
+	mu          sync.RWMutex
+	keys        map[string]*key
+	refreshedAt time.Time
+}
+
+func NewRing(store *store.RedisStore, config Config) (*Ring, error) {
+	switch config.Algorithm {
+	case AlgHS256:
+		if config.HMACSecret == "" {
+			return nil, errors.New("HS256 needs a secret")
+		}
+	case AlgRS256, AlgES256, AlgEdDSA:
+		if config.Rotation < prepublish {
+			return nil, fmt.Errorf("key rotation period must be at least %s", prepublish)
+		}
+		if config.Grace <= 0 {
+			return nil, errors.New("key grace period must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", config.Algorithm)
+	}
+
+	return &Ring{
+		store:  store,
+		config: config,
+		keys:   make(map[string]*key),
+	}, nil
+}
+
+func (r *Ring) symmetric() bool {
+	return r.config.Algorithm == AlgHS256
+}
+
+// Load loads the keys, creating the first one if there is none. It waits
+// briefly if another node is creating it.
+func (r *Ring) Load(ctx context.Context) error {
+	if r.symmetric() {
+		return nil
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		if err := r.refresh(ctx); err != nil {
+			return err
+		}
+		if _, err := r.signingKey(); err == nil {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return ErrNoSigningKey
+}
+
+// Run keeps the keys current and rotates them when due.
+func (r *Ring) Run(ctx context.Context) {
+	if r.symmetric() {
+		return
+	}
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil {
+				log.Printf("failed to refresh signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// Sign signs claims with the current key and names it in the kid header.
+func (r *Ring) Sign(claims jwt.Claims) (string, error) {
+	if r.symmetric() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(r.config.HMACSecret))
+	}
+
+	k, err := r.signingKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.signer)
+}
+
+// Keyfunc returns the key that verifies token, for jwt.Parse.
+func (r *Ring) Keyfunc(token *jwt.Token) (any, error) {
+	if r.symmetric() {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(r.config.HMACSecret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := r.verificationKey(kid)
+	if !ok {
+		// Another node may have just created the key.
+		r.mu.RLock()
+		stale := time.Since(r.refreshedAt) > minMissRefresh
+		r.mu.RUnlock()
+		if stale {
+			if err := r.refresh(context.Background()); err != nil {
+				log.Printf("failed to refresh signing keys: %v", err)
+			}
+			k, ok = r.verificationKey(kid)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method != k.method {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.signer.Public(), nil
+}
+
+func (r *Ring) verificationKey(kid string) (*key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[kid]
+	if !ok || !k.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	return k, true
+}
+
+// Methods lists the algorithms tokens may be signed with.
+func (r *Ring) Methods() []string {
+	if r.symmetric() {
+		return []string{AlgHS256}
+	}
+	return []string{AlgRS256, AlgES256, AlgEdDSA}
+}
+
+func (r *Ring) signingKey() (*key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var current *key
+	for _, k := range r.keys {
+		if k.Algorithm != r.config.Algorithm || k.ActivatesAt.After(now) || !k.ExpiresAt.After(now) {
+			continue
+		}
+		if current == nil || k.ActivatesAt.After(current.ActivatesAt) {
+			current = k
+		}
+	}
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	return current, nil
+}
+
+// refresh reloads the keys from Redis, generating the next key and dropping
+// expired ones when due.
+func (r *Ring) refresh(ctx context.Context) error {
+	stored, err := r.store.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next, due := r.nextKeyTime(stored, now)
+	if due {
+		locked, err := r.store.AcquireKeyRotationLock(ctx, rotationLockTTL)
+		if err != nil {
+			return err
+		}
+		if locked {
+			if err := r.rotate(ctx, stored, next, now); err != nil {
+				return err
+			}
+			if stored, err = r.store.GetSigningKeys(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make(map[string]*key, len(stored))
+	for _, signingKey := range stored {
+		if !signingKey.ExpiresAt.After(now) {
+			continue
+		}
+		k, err := parseKey(signingKey)
+		if err != nil {
+			log.Printf("skipping signing key %s: %v", signingKey.ID, err)
+			continue
+		}
+		keys[k.ID] = k
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.refreshedAt = now
+	r.mu.Unlock()
+	return nil
+}
+
+// nextKeyTime reports whether a new key is due and when it should start
+// signing: when the last key of the configured algorithm retires, or now if
+// there is none.
+func (r *Ring) nextKeyTime(stored []*models.SigningKey, now time.Time) (time.Time, bool) {
+	var last *models.SigningKey
+	for _, k := range stored {
+		if k.Algorithm == r.config.Algorithm && (last == nil || k.RetiresAt.After(last.RetiresAt)) {
+			last = k
+		}
+	}
+	if last == nil || !last.RetiresAt.After(now) {
+		return now, true
+	}
+	return last.RetiresAt, last.RetiresAt.Sub(now) < prepublish
+}
+
+func (r *Ring) rotate(ctx context.Context, stored []*models.SigningKey, activatesAt, now time.Time) error {
+	signingKey, err := generateKey(r.config.Algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	signingKey.CreatedAt = now
+	signingKey.ActivatesAt = activatesAt
+	signingKey.RetiresAt = activatesAt.Add(r.config.Rotation)
+	signingKey.ExpiresAt = signingKey.RetiresAt.Add(r.config.Grace)
+	if err := r.store.SaveSigningKey(ctx, signingKey); err != nil {
+		return err
+	}
+	log.Printf("created signing key %s (%s), active from %s", signingKey.ID, signingKey.Algorithm, activatesAt.Format(time.RFC3339))
+
+	var expired []string
+	for _, k := range stored {
+		if !k.ExpiresAt.After(now) {
+			expired = append(expired, k.ID)
+		}
+	}
+	return r.store.DeleteSigningKeys(ctx, expired...)
+}
+
+func generateKey(alg string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		ID:         uuid.New().String(),
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parseKey(signingKey *models.SigningKey) (*key, error) {
+	block, _ := pem.Decode([]byte(signingKey.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+
+	var method jwt.SigningMethod
+	switch signingKey.Algorithm {
+	case AlgRS256:
+		_, ok = private.(*rsa.PrivateKey)
+		method = jwt.SigningMethodRS256
+	case AlgES256:
+		_, ok = private.(*ecdsa.PrivateKey)
+		method = jwt.SigningMethodES256
+	case AlgEdDSA:
+		_, ok = private.(ed25519.PrivateKey)
+		method = jwt.SigningMethodEdDSA
+	default:
+		ok = false
+	}
+	if !ok {
+		return nil, fmt.Errorf("key does not match algorithm %s", signingKey.Algorithm)
+	}
+
+	return &key{SigningKey: signingKey, method: method, signer: signer}, nil
+}
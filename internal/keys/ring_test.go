@@ -0,0 +1,245 @@
+package keys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.RedisStore {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(mr.Host(), mr.Port())
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func newTestRing(t *testing.T, s *store.RedisStore, alg string) *Ring {
+	t.Helper()
+
+	ring, err := NewRing(s, Config{Algorithm: alg, HMACSecret: "secret", Rotation: 24 * time.Hour, Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRing() error = %v", err)
+	}
+	if err := ring.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return ring
+}
+
+// verify parses token the way the auth middleware does.
+func verify(ring *Ring, token string) error {
+	_, err := jwt.Parse(token, ring.Keyfunc, jwt.WithValidMethods(ring.Methods()))
+	return err
+}
+
+func signTestToken(t *testing.T, ring *Ring) string {
+	t.Helper()
+
+	token, err := ring.Sign(jwt.RegisteredClaims{
+		Subject:   "u1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return token
+}
+
+func TestNewRingRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"HS256 without a secret", Config{Algorithm: AlgHS256}},
+		{"short rotation", Config{Algorithm: AlgES256, Rotation: time.Minute, Grace: time.Hour}},
+		{"no grace period", Config{Algorithm: AlgES256, Rotation: 24 * time.Hour}},
+		{"unknown algorithm", Config{Algorithm: "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRing(nil, tt.config); err == nil {
+				t.Errorf("NewRing() accepted %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			s := newTestStore(t)
+			ring := newTestRing(t, s, alg)
+
+			token := signTestToken(t, ring)
+			if err := verify(ring, token); err != nil {
+				t.Errorf("verify() error = %v", err)
+			}
+
+			// Other nodes share the keys through Redis.
+			other := newTestRing(t, s, alg)
+			if err := verify(other, token); err != nil {
+				t.Errorf("verify() on another node error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejectsOtherKeys(t *testing.T) {
+	ring := newTestRing(t, newTestStore(t), AlgES256)
+	stranger := newTestRing(t, newTestStore(t), AlgES256)
+	if err := verify(ring, signTestToken(t, stranger)); err == nil {
+		t.Errorf("verify() accepted a token signed by an unknown key")
+	}
+
+	symmetric := newTestRing(t, newTestStore(t), AlgHS256)
+	if err := verify(ring, signTestToken(t, symmetric)); err == nil {
+		t.Errorf("verify() accepted an HS256 token")
+	}
+}
+
+func TestKeyfuncLoadsNewKeys(t *testing.T) {
+	s := newTestStore(t)
+	ring := newTestRing(t, s, AlgEdDSA)
+	other := newTestRing(t, s, AlgEdDSA)
+
+	// Another node rotates, and ring hasn't refreshed since.
+	now := time.Now()
+	signingKey, err := generateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatalf("generateKey() error = %v", err)
+	}
+	signingKey.ActivatesAt = now
+	signingKey.RetiresAt = now.Add(time.Hour)
+	signingKey.ExpiresAt = now.Add(2 * time.Hour)
+	if err := s.SaveSigningKey(context.Background(), signingKey); err != nil {
+		t.Fatalf("SaveSigningKey() error = %v", err)
+	}
+	if err := other.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+	token := signTestToken(t, other)
+
+	if err := verify(ring, token); err == nil {
+		t.Errorf("verify() reloaded keys within %s of the last refresh", minMissRefresh)
+	}
+	ring.mu.Lock()
+	ring.refreshedAt = now.Add(-time.Minute)
+	ring.mu.Unlock()
+	if err := verify(ring, token); err != nil {
+		t.Errorf("verify() with a new key error = %v", err)
+	}
+}
+
+func TestExpiredKeysStopVerifying(t *testing.T) {
+	ring := newTestRing(t, newTestStore(t), AlgES256)
+	token := signTestToken(t, ring)
+
+	k, err := ring.signingKey()
+	if err != nil {
+		t.Fatalf("signingKey() error = %v", err)
+	}
+	ring.mu.Lock()
+	k.ExpiresAt = time.Now().Add(-time.Second)
+	ring.mu.Unlock()
+
+	if err := verify(ring, token); err == nil {
+		t.Errorf("verify() accepted a token signed by an expired key")
+	}
+	if _, err := ring.Sign(jwt.RegisteredClaims{}); err != ErrNoSigningKey {
+		t.Errorf("Sign() with only an expired key error = %v, want %v", err, ErrNoSigningKey)
+	}
+}
+
+func TestNextKeyTime(t *testing.T) {
+	ring := &Ring{config: Config{Algorithm: AlgES256}}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		stored   []*models.SigningKey
+		wantNext time.Time
+		wantDue  bool
+	}{
+		{"no keys", nil, now, true},
+		{
+			name:     "retired",
+			stored:   []*models.SigningKey{{Algorithm: AlgES256, RetiresAt: now.Add(-time.Minute)}},
+			wantNext: now,
+			wantDue:  true,
+		},
+		{
+			name:     "retires within the prepublish period",
+			stored:   []*models.SigningKey{{Algorithm: AlgES256, RetiresAt: now.Add(prepublish / 2)}},
+			wantNext: now.Add(prepublish / 2),
+			wantDue:  true,
+		},
+		{
+			name:     "next key already published",
+			stored:   []*models.SigningKey{{Algorithm: AlgES256, RetiresAt: now.Add(time.Minute)}, {Algorithm: AlgES256, RetiresAt: now.Add(2 * prepublish)}},
+			wantNext: now.Add(2 * prepublish),
+			wantDue:  false,
+		},
+		{
+			name:     "only keys of another algorithm",
+			stored:   []*models.SigningKey{{Algorithm: AlgRS256, RetiresAt: now.Add(2 * prepublish)}},
+			wantNext: now,
+			wantDue:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, due := ring.nextKeyTime(tt.stored, now)
+			if !next.Equal(tt.wantNext) || due != tt.wantDue {
+				t.Errorf("nextKeyTime() = %v, %v; want %v, %v", next, due, tt.wantNext, tt.wantDue)
+			}
+		})
+	}
+}
+
+func TestRotationPrepublishesNextKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(mr.Host(), mr.Port())
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	ring, err := NewRing(s, Config{Algorithm: AlgES256, Rotation: prepublish, Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRing() error = %v", err)
+	}
+	if err := ring.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	current, err := ring.signingKey()
+	if err != nil {
+		t.Fatalf("signingKey() error = %v", err)
+	}
+
+	// The first key retires within the prepublish period, so the next
+	// refresh publishes its successor without signing with it yet. The
+	// rotation lock taken for the first key has to lapse first.
+	mr.FastForward(rotationLockTTL)
+	if err := ring.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+	if jwks := ring.JWKS(); len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2", len(jwks.Keys))
+	}
+	if k, err := ring.signingKey(); err != nil || k.ID != current.ID {
+		t.Errorf("signingKey() = %v, %v; want the current key %s", k, err, current.ID)
+	}
+}
@@ -0,0 +1,78 @@
+// Package mail sends transactional email such as password resets. Mailer
+// has an SMTP implementation for real delivery and log and in-memory ones
+// for development and tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them. Messages
+// carry reset and verification links, so it's only for development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// MemoryMailer keeps sent messages in memory.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *MemoryMailer) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Message(nil), m.messages...)
+}
+
+// FromEnv picks the mailer named by MAIL_DRIVER: smtp, memory or log (the
+// default). The log driver is refused unless GO_ENV is unset or
+// development. SMTP is configured with SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM.
+func FromEnv() (Mailer, error) {
+	switch driver := strings.ToLower(os.Getenv("MAIL_DRIVER")); driver {
+	case "", "log":
+		if env := os.Getenv("GO_ENV"); env != "" && env != "development" {
+			return nil, fmt.Errorf("the log mail driver writes account links to the log and is only allowed in development; set MAIL_DRIVER to smtp")
+		}
+		return LogMailer{}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	case "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %q", driver)
+	}
+}
@@ -0,0 +1,264 @@
+package markup
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var (
+	ErrRawHTML    = errors.New("raw HTML is not allowed in messages")
+	ErrUnsafeLink = errors.New("links must use http, https or mailto")
+)
+
+var htmlTagPattern = regexp.MustCompile(`<\s*/?\s*[a-zA-Z][^>]*>|<!--`)
+
+// codePlaceholder stands in for code when looking for HTML. It can't start
+// a tag name or end a tag.
+const codePlaceholder = '\uFFFD'
+
+var allowedSchemes = []string{"http", "https", "mailto"}
+
+// Format parses the Markdown subset supported by the server out of
+// msg.Content and fills in msg.PlainText and msg.Entities. The original
+// Content is left untouched so Markdown-aware clients can keep using it.
+func Format(msg *models.Message) error {
+	plain, entities, err := Parse(msg.Content)
+	if err != nil {
+		return err
+	}
+	msg.PlainText = plain
+	msg.Entities = entities
+	return nil
+}
+
+// Parse converts content into plain text and the formatting entities that
+// apply to it. Entity offsets and lengths are counted in Unicode code points
+// of the returned plain text.
+//
+// Supported syntax: **bold**, *italic* or _italic_, `code`, fenced code
+// blocks, [text](url) links and "> " quotes. Raw HTML is rejected outside
+// code spans and blocks.
+func Parse(content string) (string, []models.MessageEntity, error) {
+	p := &parser{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		if i > 0 {
+			p.write("\n")
+		}
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			lang := strings.TrimSpace(strings.TrimPrefix(line, "```"))
+			var body []string
+			for i+1 < len(lines) {
+				i++
+				if strings.TrimSpace(lines[i]) == "```" {
+					break
+				}
+				body = append(body, lines[i])
+			}
+			start := p.n
+			p.write(strings.Join(body, "\n"))
+			p.add(models.EntityPre, start, models.MessageEntity{Language: lang})
+
+		case strings.HasPrefix(line, ">"):
+			start := p.n
+			for {
+				quoted := strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+				if err := p.inline([]rune(quoted)); err != nil {
+					return "", nil, err
+				}
+				if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], ">") {
+					break
+				}
+				i++
+				line = lines[i]
+				p.write("\n")
+			}
+			p.add(models.EntityQuote, start, models.MessageEntity{})
+
+		default:
+			if err := p.inline([]rune(line)); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	slices.SortStableFunc(p.entities, func(a, b models.MessageEntity) int {
+		return a.Offset - b.Offset
+	})
+
+	plain := p.out.String()
+	if containsHTML(plain, p.entities) {
+		return "", nil, ErrRawHTML
+	}
+	return plain, p.entities, nil
+}
+
+// containsHTML reports whether the rendered text has HTML outside code,
+// where it is shown literally. Code is blanked out rather than skipped, so
+// a tag split around a code span is still caught.
+func containsHTML(plain string, entities []models.MessageEntity) bool {
+	runes := []rune(plain)
+	for _, e := range entities {
+		if e.Type != models.EntityCode && e.Type != models.EntityPre {
+			continue
+		}
+		for i := e.Offset; i < e.Offset+e.Length; i++ {
+			runes[i] = codePlaceholder
+		}
+	}
+	return htmlTagPattern.MatchString(string(runes))
+}
+
+type parser struct {
+	out      strings.Builder
+	n        int
+	entities []models.MessageEntity
+}
+
+func (p *parser) write(s string) {
+	p.out.WriteString(s)
+	p.n += len([]rune(s))
+}
+
+func (p *parser) writeRune(r rune) {
+	p.out.WriteRune(r)
+	p.n++
+}
+
+func (p *parser) add(t models.EntityType, start int, e models.MessageEntity) {
+	if p.n == start {
+		return
+	}
+	e.Type = t
+	e.Offset = start
+	e.Length = p.n - start
+	p.entities = append(p.entities, e)
+}
+
+func (p *parser) inline(s []rune) error {
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && isEscapable(s[i+1]):
+			p.writeRune(s[i+1])
+			i += 2
+			continue
+
+		case s[i] == '`':
+			if j := find(s, i+1, "`"); j > i+1 {
+				start := p.n
+				p.write(string(s[i+1 : j]))
+				p.add(models.EntityCode, start, models.MessageEntity{})
+				i = j + 1
+				continue
+			}
+
+		case s[i] == '*' && i+1 < len(s) && s[i+1] == '*':
+			if j := find(s, i+2, "**"); j > i+2 {
+				start := p.n
+				if err := p.inline(s[i+2 : j]); err != nil {
+					return err
+				}
+				p.add(models.EntityBold, start, models.MessageEntity{})
+				i = j + 2
+				continue
+			}
+
+		case s[i] == '*' || (s[i] == '_' && (i == 0 || !isWordRune(s[i-1]))):
+			if j := findItalicEnd(s, i+1, s[i]); j > i+1 {
+				start := p.n
+				if err := p.inline(s[i+1 : j]); err != nil {
+					return err
+				}
+				p.add(models.EntityItalic, start, models.MessageEntity{})
+				i = j + 1
+				continue
+			}
+
+		case s[i] == '[':
+			if mid := find(s, i+1, "]("); mid > i {
+				if end := find(s, mid+2, ")"); end > mid+2 {
+					href := strings.TrimSpace(string(s[mid+2 : end]))
+					if !isSafeURL(href) {
+						return ErrUnsafeLink
+					}
+					start := p.n
+					if mid == i+1 {
+						p.write(href)
+					} else if err := p.inline(s[i+1 : mid]); err != nil {
+						return err
+					}
+					p.add(models.EntityLink, start, models.MessageEntity{URL: href})
+					i = end + 1
+					continue
+				}
+			}
+		}
+
+		p.writeRune(s[i])
+		i++
+	}
+	return nil
+}
+
+// find returns the index of the first unescaped occurrence of delim in s at
+// or after from, or -1.
+func find(s []rune, from int, delim string) int {
+	d := []rune(delim)
+	for j := from; j+len(d) <= len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if slices.Equal(s[j:j+len(d)], d) {
+			return j
+		}
+	}
+	return -1
+}
+
+func findItalicEnd(s []rune, from int, delim rune) int {
+	for j := from; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] != delim {
+			continue
+		}
+		if delim == '*' && j+1 < len(s) && s[j+1] == '*' {
+			j++
+			continue
+		}
+		if delim == '_' && j+1 < len(s) && isWordRune(s[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isEscapable(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSafeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(allowedSchemes, strings.ToLower(u.Scheme))
+}
@@ -0,0 +1,135 @@
+package markup
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		plain    string
+		entities []models.MessageEntity
+	}{
+		{
+			name:    "plain text",
+			content: "hello world",
+			plain:   "hello world",
+		},
+		{
+			name:     "bold",
+			content:  "a **b** c",
+			plain:    "a b c",
+			entities: []models.MessageEntity{{Type: models.EntityBold, Offset: 2, Length: 1}},
+		},
+		{
+			name:     "italic with underscores",
+			content:  "_hi_ there",
+			plain:    "hi there",
+			entities: []models.MessageEntity{{Type: models.EntityItalic, Offset: 0, Length: 2}},
+		},
+		{
+			name:    "underscores inside words",
+			content: "snake_case_name",
+			plain:   "snake_case_name",
+		},
+		{
+			name:     "code span",
+			content:  "run `go test`",
+			plain:    "run go test",
+			entities: []models.MessageEntity{{Type: models.EntityCode, Offset: 4, Length: 7}},
+		},
+		{
+			name:     "code block",
+			content:  "```go\nfmt.Println()\n```",
+			plain:    "fmt.Println()",
+			entities: []models.MessageEntity{{Type: models.EntityPre, Offset: 0, Length: 13, Language: "go"}},
+		},
+		{
+			name:     "link",
+			content:  "see [docs](https://example.com)",
+			plain:    "see docs",
+			entities: []models.MessageEntity{{Type: models.EntityLink, Offset: 4, Length: 4, URL: "https://example.com"}},
+		},
+		{
+			name:     "quote",
+			content:  "> quoted\n> more",
+			plain:    "quoted\nmore",
+			entities: []models.MessageEntity{{Type: models.EntityQuote, Offset: 0, Length: 11}},
+		},
+		{
+			name:    "escaped markers",
+			content: `\*not bold\*`,
+			plain:   "*not bold*",
+		},
+		{
+			name:     "offsets count code points",
+			content:  "héllo **wörld**",
+			plain:    "héllo wörld",
+			entities: []models.MessageEntity{{Type: models.EntityBold, Offset: 6, Length: 5}},
+		},
+		{
+			name:     "HTML in a code span",
+			content:  "use `<div>` here",
+			plain:    "use <div> here",
+			entities: []models.MessageEntity{{Type: models.EntityCode, Offset: 4, Length: 5}},
+		},
+		{
+			name:     "HTML in a code block",
+			content:  "```\n<script>alert(1)</script>\n```",
+			plain:    "<script>alert(1)</script>",
+			entities: []models.MessageEntity{{Type: models.EntityPre, Offset: 0, Length: 25}},
+		},
+		{
+			name:    "comparison operators",
+			content: "1 < 2 and 3 > 2",
+			plain:   "1 < 2 and 3 > 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, entities, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.content, err)
+			}
+			if plain != tt.plain {
+				t.Errorf("plain = %q, want %q", plain, tt.plain)
+			}
+			if len(entities) == 0 && len(tt.entities) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.entities)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{"tag", "<b>hi</b>", ErrRawHTML},
+		{"comment", "<!-- hidden -->", ErrRawHTML},
+		{"tag inside bold", "**<img src=x>**", ErrRawHTML},
+		{"tag split around a code span", "<a `x` href=y>", ErrRawHTML},
+		{"tag split by bold", "<di**v>**", ErrRawHTML},
+		{"javascript link", "[x](javascript:alert(1))", ErrUnsafeLink},
+		{"relative link", "[x](/path)", ErrUnsafeLink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Parse(tt.content); !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.content, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditEventType string
+
+const (
+	AuditLoginSucceeded AuditEventType = "login_succeeded"
+	AuditLoginFailed    AuditEventType = "login_failed"
+	AuditLoginLocked    AuditEventType = "login_locked"
+	AuditMFAFailed      AuditEventType = "mfa_failed"
+	AuditSessionRevoked AuditEventType = "session_revoked"
+
+	AuditPasswordChanged      AuditEventType = "password_changed"
+	AuditPasswordChangeFailed AuditEventType = "password_change_failed"
+	AuditPasswordResetSent    AuditEventType = "password_reset_sent"
+	AuditPasswordReset        AuditEventType = "password_reset"
+
+	AuditEmailChanged  AuditEventType = "email_changed"
+	AuditEmailVerified AuditEventType = "email_verified"
+)
+
+// AuditEvent records a security-relevant action for later review. UserID
+// is empty when the action names a username that doesn't exist.
+type AuditEvent struct {
+	ID        string         `json:"id"`
+	Type      AuditEventType `json:"type"`
+	UserID    string         `json:"user_id,omitempty"`
+	Username  string         `json:"username,omitempty"`
+	IP        string         `json:"ip"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	Detail    string         `json:"detail,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func NewAuditEvent(eventType AuditEventType, ip, userAgent string) *AuditEvent {
+	return &AuditEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIScope is a part of the API an API key may be used for.
+type APIScope string
+
+const (
+	ScopeMessagesRead  APIScope = "messages:read"
+	ScopeMessagesWrite APIScope = "messages:write"
+	ScopeGroupsRead    APIScope = "groups:read"
+	ScopeGroupsWrite   APIScope = "groups:write"
+)
+
+func (s APIScope) IsValid() bool {
+	switch s {
+	case ScopeMessagesRead, ScopeMessagesWrite, ScopeGroupsRead, ScopeGroupsWrite:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey lets a bot call the API without logging in. Only a hash of the key
+// is stored; Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         string     `json:"id"`
+	BotID      string     `json:"bot_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []APIScope `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func NewAPIKey(botID, name, prefix string, scopes []APIScope) *APIKey {
+	return &APIKey{
+		ID:        uuid.New().String(),
+		BotID:     botID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (k *APIKey) HasScope(scope APIScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// NewBot creates a bot user managed by ownerID. Bots have no password and
+// authenticate with API keys.
+func NewBot(username, ownerID string) *User {
+	return &User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		IsBot:     true,
+		OwnerID:   ownerID,
+		CreatedAt: time.Now(),
+	}
+}
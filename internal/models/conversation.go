@@ -0,0 +1,30 @@
+package models
+
+import "fmt"
+
+const BroadcastConversationID = "broadcast"
+
+// GroupConversationID returns the conversation identifier for a group chat.
+func GroupConversationID(groupID string) string {
+	return fmt.Sprintf("group:%s", groupID)
+}
+
+// PrivateConversationID returns the conversation identifier shared by both
+// participants of a private chat, independent of argument order.
+func PrivateConversationID(user1, user2 string) string {
+	if user2 < user1 {
+		user1, user2 = user2, user1
+	}
+	return fmt.Sprintf("private:%s:%s", user1, user2)
+}
+
+func (m *Message) ConversationID() string {
+	switch m.Type {
+	case MessageTypePrivate:
+		return PrivateConversationID(m.FromID, m.ToID)
+	case MessageTypeGroup:
+		return GroupConversationID(m.GroupID)
+	default:
+		return BroadcastConversationID
+	}
+}
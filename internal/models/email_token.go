@@ -0,0 +1,16 @@
+package models
+
+type EmailTokenPurpose string
+
+const (
+	EmailTokenVerify        EmailTokenPurpose = "verify_email"
+	EmailTokenPasswordReset EmailTokenPurpose = "password_reset"
+)
+
+// EmailToken is what a link sent by email lets its holder do. Only its hash
+// is stored.
+type EmailToken struct {
+	Purpose EmailTokenPurpose `json:"purpose"`
+	UserID  string            `json:"user_id"`
+	Email   string            `json:"email"`
+}
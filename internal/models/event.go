@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type EventType string
+
+const (
+	EventMessagePinned   EventType = "message_pinned"
+	EventMessageUnpinned EventType = "message_unpinned"
+	EventMessageExpired  EventType = "message_expired"
+	EventMessageTTLSet   EventType = "message_ttl_updated"
+	EventPollUpdated     EventType = "poll_updated"
+	EventMessageDeleted  EventType = "message_deleted"
+)
+
+// Event is published on the same pub/sub channels as messages to notify
+// connected clients about changes to existing conversation state. Its Type
+// never collides with a MessageType, so clients can tell the two apart.
+type Event struct {
+	Type           EventType `json:"type"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id,omitempty"`
+	ActorID        string    `json:"actor_id,omitempty"`
+	Data           any       `json:"data,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+func NewEvent(eventType EventType, conversationID, actorID string) *Event {
+	return &Event{
+		Type:           eventType,
+		ConversationID: conversationID,
+		ActorID:        actorID,
+		Timestamp:      time.Now(),
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a
+// user. Subject is the provider's stable ID for the account.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// OIDCLogin is a sign-in in progress, kept between the redirect to the
+// provider and the callback. LinkUserID is set when a signed-in user is
+// linking the provider account instead of signing in with it.
+type OIDCLogin struct {
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	LinkUserID   string    `json:"link_user_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
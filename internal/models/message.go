@@ -1,6 +1,7 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,15 +28,64 @@ func (mt MessageType) IsValid() bool {
 	}
 }
 
+type EntityType string
+
+const (
+	EntityBold   EntityType = "bold"
+	EntityItalic EntityType = "italic"
+	EntityCode   EntityType = "code"
+	EntityPre    EntityType = "pre"
+	EntityLink   EntityType = "link"
+	EntityQuote  EntityType = "quote"
+)
+
+// MessageEntity marks a formatted span of Message.PlainText. Offset and
+// Length are counted in Unicode code points.
+type MessageEntity struct {
+	Type     EntityType `json:"type"`
+	Offset   int        `json:"offset"`
+	Length   int        `json:"length"`
+	URL      string     `json:"url,omitempty"`      // For links
+	Language string     `json:"language,omitempty"` // For code blocks
+}
+
+// Attachment references a file the client uploaded elsewhere. The server
+// only stores the reference, so forwarding a message never re-uploads it.
+type Attachment struct {
+	URL         string `json:"url" validate:"required,url"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ForwardedFrom records where a forwarded message originally came from.
+type ForwardedFrom struct {
+	MessageID      string    `json:"message_id"`
+	FromID         string    `json:"from_id"`
+	FromUser       string    `json:"from_user"`
+	ConversationID string    `json:"conversation_id"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
 type Message struct {
-	ID        string      `json:"id"`
-	Type      MessageType `json:"type"` // "private", "group", or "broadcast"
-	Content   string      `json:"content"`
-	FromID    string      `json:"from_id"`
-	FromUser  string      `json:"from_user"`
-	ToID      string      `json:"to_id,omitempty"`    // For private
-	GroupID   string      `json:"group_id,omitempty"` // For group
-	Timestamp time.Time   `json:"timestamp"`
+	ID          string            `json:"id"`
+	ClientMsgID string            `json:"client_msg_id,omitempty"` // Echoed back so senders can reconcile
+	Type        MessageType       `json:"type"`                    // "private", "group", or "broadcast"
+	Content     string            `json:"content"`
+	PlainText   string            `json:"plain_text"` // Content with Markdown stripped
+	Entities    []MessageEntity   `json:"entities,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	Poll        *Poll             `json:"poll,omitempty"`
+	Forwarded   *ForwardedFrom    `json:"forwarded_from,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"` // Set by plugins
+	FromID      string            `json:"from_id"`
+	FromUser    string            `json:"from_user"`
+	FromBot     bool              `json:"from_bot,omitempty"`
+	ToID        string            `json:"to_id,omitempty"`      // For private
+	GroupID     string            `json:"group_id,omitempty"`   // For group
+	SendAt      *time.Time        `json:"send_at,omitempty"`    // For scheduled messages
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"` // For disappearing messages
+	Timestamp   time.Time         `json:"timestamp"`
 }
 
 func NewMessage(msgType string, content, fromID, fromUser string) *Message {
@@ -49,11 +99,61 @@ func NewMessage(msgType string, content, fromID, fromUser string) *Message {
 	}
 }
 
+// Forward returns a new message from fromID that carries m's content,
+// formatting and attachments. The recipient must be set by the caller.
+// Forwarding a forwarded message keeps pointing at the original.
+func (m *Message) Forward(msgType MessageType, fromID, fromUser string) *Message {
+	fwd := *m
+	fwd.ID = uuid.New().String()
+	fwd.ClientMsgID = ""
+	fwd.Type = msgType
+	fwd.FromID = fromID
+	fwd.FromUser = fromUser
+	fwd.FromBot = false
+	fwd.ToID = ""
+	fwd.GroupID = ""
+	fwd.Entities = slices.Clone(m.Entities)
+	fwd.Attachments = slices.Clone(m.Attachments)
+	fwd.Annotations = nil
+	fwd.Poll = nil // Votes belong to the original conversation
+	fwd.SendAt = nil
+	fwd.ExpiresAt = nil
+	fwd.Timestamp = time.Now()
+
+	if m.Forwarded != nil {
+		origin := *m.Forwarded
+		fwd.Forwarded = &origin
+	} else {
+		fwd.Forwarded = &ForwardedFrom{
+			MessageID:      m.ID,
+			FromID:         m.FromID,
+			FromUser:       m.FromUser,
+			ConversationID: m.ConversationID(),
+			Timestamp:      m.Timestamp,
+		}
+	}
+
+	return &fwd
+}
+
 func (m *Message) SetPrivateRecipient(toID string) {
 	m.ToID = toID
 	m.GroupID = ""
 }
 
+// Schedule marks the message to be delivered at sendAt instead of immediately.
+func (m *Message) Schedule(sendAt time.Time) {
+	m.SendAt = &sendAt
+}
+
+func (m *Message) HasAttachments() bool {
+	return len(m.Attachments) > 0
+}
+
+func (m *Message) IsExpired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
 func (m *Message) SetGroupRecipient(groupID string) {
 	m.GroupID = groupID
 	m.ToID = ""
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TOTPConfig is a user's authenticator app enrollment. It is pending until
+// the user confirms it with a code; only then is a second factor required
+// at login.
+type TOTPConfig struct {
+	Secret    string     `json:"secret"` // Base32, as shown to the user
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+}
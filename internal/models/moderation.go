@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// GlobalModerationScope holds the rules applied to every message. Group rules
+// are stored under the group's conversation ID and apply on top of them.
+const GlobalModerationScope = "global"
+
+type ModerationRuleType string
+
+const (
+	RuleKeyword  ModerationRuleType = "keyword"  // Whole-word, case-insensitive block list
+	RuleRegex    ModerationRuleType = "regex"    // Regular expression block list
+	RuleLink     ModerationRuleType = "link"     // Link domain allow/deny lists
+	RuleMentions ModerationRuleType = "mentions" // Maximum @mentions per message
+	RuleRepeat   ModerationRuleType = "repeat"   // Same message sent too often
+)
+
+type ModerationAction string
+
+const (
+	ActionReject ModerationAction = "reject"
+	ActionMask   ModerationAction = "mask"
+	ActionFlag   ModerationAction = "flag"
+	ActionMute   ModerationAction = "mute" // Mutes the sender in the group and rejects the message
+)
+
+type ModerationRule struct {
+	Name          string             `json:"name"`
+	Type          ModerationRuleType `json:"type"`
+	Words         []string           `json:"words,omitempty"`          // keyword
+	Patterns      []string           `json:"patterns,omitempty"`       // regex
+	AllowDomains  []string           `json:"allow_domains,omitempty"`  // link
+	DenyDomains   []string           `json:"deny_domains,omitempty"`   // link
+	Max           int                `json:"max,omitempty"`            // mentions, repeat
+	WindowSeconds int                `json:"window_seconds,omitempty"` // repeat
+	Action        ModerationAction   `json:"action"`
+	MuteSeconds   int                `json:"mute_seconds,omitempty"` // mute
+}
+
+// ModerationRules is the rule set for one scope. In dry-run mode matches are
+// only logged.
+type ModerationRules struct {
+	DryRun    bool             `json:"dry_run"`
+	Rules     []ModerationRule `json:"rules"`
+	UpdatedBy string           `json:"updated_by,omitempty"`
+	UpdatedAt time.Time        `json:"updated_at,omitempty"`
+}
+
+// ModerationFlag records a message a rule flagged for review.
+type ModerationFlag struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	Rule           string    `json:"rule"`
+	FlaggedAt      time.Time `json:"flagged_at"`
+	Message        *Message  `json:"message,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const MaxPinsPerConversation = 20
+
+type Pin struct {
+	MessageID string    `json:"message_id"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+	Message   *Message  `json:"message,omitempty"`
+}
+
+func NewPin(messageID, pinnedBy string) *Pin {
+	return &Pin{
+		MessageID: messageID,
+		PinnedBy:  pinnedBy,
+		PinnedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrPollClosed    = errors.New("poll is closed")
+	ErrInvalidVote   = errors.New("invalid poll option")
+	ErrSingleChoice  = errors.New("poll allows only one option")
+	ErrNotAPoll      = errors.New("message is not a poll")
+	ErrEmptyPollVote = errors.New("at least one option is required")
+)
+
+// Poll is attached to a group Message whose Content holds the question.
+type Poll struct {
+	Question       string       `json:"question"`
+	Options        []string     `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	Results        *PollResults `json:"results,omitempty"` // Filled in when read, never stored
+}
+
+type PollResults struct {
+	Counts      []int64    `json:"counts"`
+	TotalVoters int64      `json:"total_voters"`
+	Voters      [][]string `json:"voters,omitempty"`  // Per option, only for non-anonymous polls
+	MyVote      []int      `json:"my_vote,omitempty"` // The caller's own vote
+}
+
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosesAt != nil && !p.ClosesAt.After(now)
+}
+
+// NormalizeVote validates the chosen option indexes and returns them sorted
+// and without duplicates.
+func (p *Poll) NormalizeVote(options []int) ([]int, error) {
+	if len(options) == 0 {
+		return nil, ErrEmptyPollVote
+	}
+
+	vote := slices.Clone(options)
+	slices.Sort(vote)
+	vote = slices.Compact(vote)
+
+	if !p.MultipleChoice && len(vote) > 1 {
+		return nil, ErrSingleChoice
+	}
+	for _, opt := range vote {
+		if opt < 0 || opt >= len(p.Options) {
+			return nil, ErrInvalidVote
+		}
+	}
+	return vote, nil
+}
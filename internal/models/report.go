@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+func (s ReportStatus) IsValid() bool {
+	switch s {
+	case ReportOpen, ReportActioned, ReportDismissed:
+		return true
+	default:
+		return false
+	}
+}
+
+type ReportAction string
+
+const (
+	ReportActionDismiss       ReportAction = "dismiss"
+	ReportActionDeleteMessage ReportAction = "delete_message"
+	ReportActionRemoveMember  ReportAction = "remove_member"
+	ReportActionSuspendUser   ReportAction = "suspend_user"
+)
+
+// Report is a user's report of an abusive message or account. Message
+// reports keep a copy of the message as it was when reported.
+type Report struct {
+	ID             string       `json:"id"`
+	ReporterID     string       `json:"reporter_id"`
+	UserID         string       `json:"user_id"` // The reported user, or the message's sender
+	MessageID      string       `json:"message_id,omitempty"`
+	ConversationID string       `json:"conversation_id,omitempty"`
+	Reason         string       `json:"reason"`
+	Details        string       `json:"details,omitempty"`
+	Message        *Message     `json:"message,omitempty"`
+	Status         ReportStatus `json:"status"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Action         ReportAction `json:"action,omitempty"`
+	Note           string       `json:"note,omitempty"`
+	ResolvedBy     string       `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time   `json:"resolved_at,omitempty"`
+}
+
+func NewReport(reporterID, reason, details string) *Report {
+	return &Report{
+		ID:         uuid.New().String(),
+		ReporterID: reporterID,
+		Reason:     reason,
+		Details:    details,
+		Status:     ReportOpen,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// SetMessage points the report at msg and its sender.
+func (r *Report) SetMessage(msg *Message) {
+	r.MessageID = msg.ID
+	r.UserID = msg.FromID
+	r.ConversationID = msg.ConversationID()
+	r.Message = msg
+}
+
+// Target identifies what the report is about, so a user can only have one
+// open report per message or account.
+func (r *Report) Target() string {
+	if r.MessageID != "" {
+		return "message:" + r.MessageID
+	}
+	return "user:" + r.UserID
+}
+
+// Resolve closes the report with the action taken by a moderator.
+func (r *Report) Resolve(action ReportAction, moderatorID, note string) {
+	now := time.Now()
+	r.Status = ReportActioned
+	if action == ReportActionDismiss {
+		r.Status = ReportDismissed
+	}
+	r.Action = action
+	r.Note = note
+	r.ResolvedBy = moderatorID
+	r.ResolvedAt = &now
+}
+
+// Suspension blocks a user from using the API. A nil Until suspends the
+// user indefinitely.
+type Suspension struct {
+	UserID      string     `json:"user_id"`
+	Reason      string     `json:"reason,omitempty"`
+	SuspendedBy string     `json:"suspended_by"`
+	SuspendedAt time.Time  `json:"suspended_at"`
+	Until       *time.Time `json:"until,omitempty"`
+}
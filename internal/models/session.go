@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Session is a login on one device. Its ID is the refresh token family
+// and the sid claim of the access tokens issued for the login.
+type Session struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	DeviceName   string    `json:"device_name"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	IP           string    `json:"ip"` // Where the session was last active
+	CreatedAt    time.Time `json:"created_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+}
+
+func NewSession(id, userID, deviceName, userAgent, ip string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:           id,
+		UserID:       userID,
+		DeviceName:   deviceName,
+		UserAgent:    userAgent,
+		IP:           ip,
+		CreatedAt:    now,
+		LastActiveAt: now,
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKey is a private key used to sign access tokens. A key signs tokens
+// from ActivatesAt until RetiresAt and verifies them until ExpiresAt, which
+// leaves a grace period for tokens it signed last.
+type SigningKey struct {
+	ID          string    `json:"kid"`
+	Algorithm   string    `json:"alg"`
+	PrivateKey  string    `json:"private_key"` // PKCS #8, PEM encoded
+	CreatedAt   time.Time `json:"created_at"`
+	ActivatesAt time.Time `json:"activates_at"`
+	RetiresAt   time.Time `json:"retires_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
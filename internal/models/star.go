@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Star is a user's bookmark of a message. It references the message by ID,
+// so reading it always returns the message's current state.
+type Star struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	StarredAt      time.Time `json:"starred_at"`
+	Deleted        bool      `json:"deleted,omitempty"` // The message no longer exists
+	Message        *Message  `json:"message,omitempty"`
+}
+
+func NewStar(msg *Message) *Star {
+	return &Star{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID(),
+		StarredAt:      time.Now(),
+	}
+}
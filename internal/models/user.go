@@ -1,61 +1,49 @@
 package models
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+
+	"github.com/bm-197/go-chat/internal/password"
 )
 
 type User struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-func (u *User) MarshalJSON() ([]byte, error) {
-	type Alias User
-	return json.Marshal(&struct {
-		*Alias
-		Password string `json:"password,omitempty"`
-	}{
-		Alias:    (*Alias)(u),
-		Password: u.Password,
-	})
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Password      string    `json:"-"`               // Empty for users who only sign in with a provider
+	Email         string    `json:"email,omitempty"` // Password resets go here once verified
+	EmailVerified bool      `json:"email_verified"`
+	IsBot         bool      `json:"is_bot"`
+	OwnerID       string    `json:"owner_id,omitempty"`      // For bots, the user who manages them
+	CanBroadcast  bool      `json:"can_broadcast,omitempty"` // For bots, granted by an admin; users always can
+	CreatedAt     time.Time `json:"created_at"`
 }
 
-func (u *User) UnmarshalJSON(data []byte) error {
-	type Alias User
-	aux := &struct {
-		*Alias
-		Password string `json:"password,omitempty"`
-	}{
-		Alias: (*Alias)(u),
-	}
-	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
+// NewUser creates a user with a password hashed by password.Manager.
+func NewUser(username, passwordHash string) *User {
+	return &User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Password:  passwordHash,
+		CreatedAt: time.Now(),
 	}
-	u.Password = aux.Password
-	return nil
 }
 
-func NewUser(username, password string) (*User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost+2)
-	if err != nil {
-		return nil, err
-	}
-
+// NewExternalUser creates a user who signs in through an identity provider
+// and has no password.
+func NewExternalUser(username string) *User {
 	return &User{
 		ID:        uuid.New().String(),
 		Username:  username,
-		Password:  string(hashedPassword),
 		CreatedAt: time.Now(),
-	}, nil
+	}
+}
+
+func (u *User) HasPassword() bool {
+	return u.Password != ""
 }
 
-func (u *User) ValidatePassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+func (u *User) ValidatePassword(plaintext string) bool {
+	return u.HasPassword() && password.Verify(u.Password, plaintext)
 }
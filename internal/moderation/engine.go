@@ -0,0 +1,212 @@
+// Package moderation evaluates configurable rules against every outgoing
+// message. Rules are stored in Redis globally and per group; group rules run
+// after the global ones. Each rule's action rejects the message, masks the
+// offending text, flags the message for review or mutes the sender in the
+// group. A rule set in dry-run mode only logs what it would have done.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	pluginName = "moderation"
+
+	// cacheTTL bounds how stale cached rules can get if a reload
+	// notification is missed.
+	cacheTTL = time.Minute
+
+	// pendingFlagTTL bounds how long a flag waits for its message to be
+	// saved, on top of any schedule, which covers delivery retries.
+	pendingFlagTTL = 24 * time.Hour
+)
+
+// Engine is a plugin that enforces moderation rules in PreSend and records
+// flagged messages for review in PostSend, once they're saved. Flags never
+// appear on the message itself. It caches compiled rules and reloads a scope
+// whenever its rules change.
+type Engine struct {
+	store *store.RedisStore
+
+	mu    sync.RWMutex
+	cache map[string]*ruleSet
+}
+
+func NewEngine(store *store.RedisStore) *Engine {
+	return &Engine{
+		store: store,
+		cache: make(map[string]*ruleSet),
+	}
+}
+
+func (e *Engine) Name() string {
+	return pluginName
+}
+
+// Run listens for rule changes made on any node and drops the cached rules
+// for the changed scope.
+func (e *Engine) Run(ctx context.Context) {
+	pubsub := e.store.Subscribe(ctx, store.ModerationRulesChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			e.mu.Lock()
+			delete(e.cache, msg.Payload)
+			e.mu.Unlock()
+		}
+	}
+}
+
+func (e *Engine) PreSend(ctx context.Context, msg *models.Message) error {
+	scopes := []string{models.GlobalModerationScope}
+	if msg.Type == models.MessageTypeGroup {
+		until, err := e.store.GetGroupMute(ctx, msg.GroupID, msg.FromID)
+		if err != nil {
+			return err
+		}
+		if until != nil {
+			return plugin.Reject(pluginName, fmt.Sprintf("you are muted in this group until %s", until.Format(time.RFC3339)))
+		}
+		scopes = append(scopes, msg.ConversationID())
+	}
+
+	var flags []string
+	for _, scope := range scopes {
+		set, err := e.rules(ctx, scope)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range set.rules {
+			matched, err := e.evaluate(ctx, scope, r, msg)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				continue
+			}
+
+			if set.dryRun {
+				log.Printf("moderation dry run: rule %q in %s would %s message %s from %s",
+					r.Name, scope, r.Action, msg.ID, msg.FromID)
+				continue
+			}
+
+			switch r.Action {
+			case models.ActionReject:
+				return plugin.Reject(pluginName, fmt.Sprintf("message blocked by rule %q", r.Name))
+			case models.ActionMute:
+				if msg.Type != models.MessageTypeGroup {
+					return plugin.Reject(pluginName, fmt.Sprintf("message blocked by rule %q", r.Name))
+				}
+				if err := e.store.MuteGroupMember(ctx, msg.GroupID, msg.FromID, r.mute); err != nil {
+					return err
+				}
+				return plugin.Reject(pluginName, fmt.Sprintf("message blocked by rule %q; you are muted in this group for %s", r.Name, r.mute))
+			case models.ActionMask:
+				if r.Type == models.RuleLink {
+					maskLinks(msg, r.blockedLinks(msg))
+				} else {
+					r.maskText(msg)
+				}
+			case models.ActionFlag:
+				flags = append(flags, r.Name)
+			}
+		}
+	}
+
+	if len(flags) == 0 {
+		return nil
+	}
+
+	ttl := pendingFlagTTL
+	if msg.SendAt != nil {
+		ttl += time.Until(*msg.SendAt)
+	}
+	return e.store.SavePendingFlag(ctx, msg.ID, strings.Join(flags, ","), ttl)
+}
+
+// PostSend records the flags PreSend found, now that the message is saved.
+func (e *Engine) PostSend(ctx context.Context, msg *models.Message) error {
+	rules, err := e.store.TakePendingFlag(ctx, msg.ID)
+	if err != nil || rules == "" {
+		return err
+	}
+
+	flagged := *msg
+	return e.store.FlagMessage(ctx, &models.ModerationFlag{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID(),
+		SenderID:       msg.FromID,
+		Rule:           rules,
+		FlaggedAt:      time.Now(),
+		Message:        &flagged,
+	})
+}
+
+// evaluate reports whether a rule matches msg.
+func (e *Engine) evaluate(ctx context.Context, scope string, r *rule, msg *models.Message) (bool, error) {
+	switch r.Type {
+	case models.RuleKeyword, models.RuleRegex:
+		return r.matchesText(msg), nil
+	case models.RuleLink:
+		return len(r.blockedLinks(msg)) > 0, nil
+	case models.RuleMentions:
+		return countMentions(msg) > r.Max, nil
+	case models.RuleRepeat:
+		fp := fingerprint(msg)
+		if fp == "" {
+			return false, nil
+		}
+		count, err := e.store.CountRepeatedMessage(ctx, scope+":"+r.Name, msg.FromID, fp, r.window)
+		if err != nil {
+			return false, err
+		}
+		return count > int64(r.Max), nil
+	}
+	return false, nil
+}
+
+// rules returns the compiled rules for a scope, loading them on a cache
+// miss. Rules that fail to compile are logged and skipped so a bad rule set
+// never blocks all sends.
+func (e *Engine) rules(ctx context.Context, scope string) (*ruleSet, error) {
+	e.mu.RLock()
+	set, ok := e.cache[scope]
+	e.mu.RUnlock()
+	if ok && time.Since(set.loadedAt) < cacheTTL {
+		return set, nil
+	}
+
+	config, err := e.store.GetModerationRules(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	set, err = compile(config)
+	if err != nil {
+		log.Printf("ignoring invalid moderation rules for %s: %v", scope, err)
+		set = &ruleSet{loadedAt: time.Now()}
+	}
+
+	e.mu.Lock()
+	e.cache[scope] = set
+	e.mu.Unlock()
+	return set, nil
+}
@@ -0,0 +1,118 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+func newTestEngine(t *testing.T, rules ...models.ModerationRule) (*Engine, *store.RedisStore) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(mr.Host(), mr.Port())
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	err = s.SaveModerationRules(context.Background(), models.GlobalModerationScope, &models.ModerationRules{Rules: rules})
+	if err != nil {
+		t.Fatalf("SaveModerationRules() error = %v", err)
+	}
+	return NewEngine(s), s
+}
+
+func newTestMessage(text string) *models.Message {
+	msg := models.NewMessage(string(models.MessageTypeBroadcast), text, "alice", "alice")
+	msg.PlainText = text
+	return msg
+}
+
+func TestPreSendRejects(t *testing.T) {
+	e, _ := newTestEngine(t, models.ModerationRule{Name: "no-spam", Type: models.RuleKeyword, Words: []string{"spam"}, Action: models.ActionReject})
+
+	err := e.PreSend(context.Background(), newTestMessage("buy spam"))
+	var rejection *plugin.RejectError
+	if !errors.As(err, &rejection) {
+		t.Fatalf("PreSend() error = %v, want a rejection", err)
+	}
+
+	if err := e.PreSend(context.Background(), newTestMessage("hello")); err != nil {
+		t.Errorf("PreSend() error = %v for a clean message", err)
+	}
+}
+
+func TestPreSendMasks(t *testing.T) {
+	e, _ := newTestEngine(t, models.ModerationRule{Type: models.RuleKeyword, Words: []string{"darn"}, Action: models.ActionMask})
+
+	msg := newTestMessage("oh darn")
+	if err := e.PreSend(context.Background(), msg); err != nil {
+		t.Fatalf("PreSend() error = %v", err)
+	}
+	if msg.Content != "oh ••••" || msg.PlainText != "oh ••••" {
+		t.Errorf("masked message = %q / %q, want %q", msg.Content, msg.PlainText, "oh ••••")
+	}
+}
+
+func TestFlagsAreRecordedAfterSaving(t *testing.T) {
+	e, s := newTestEngine(t, models.ModerationRule{Name: "crypto", Type: models.RuleKeyword, Words: []string{"crypto"}, Action: models.ActionFlag})
+	ctx := context.Background()
+
+	msg := newTestMessage("free crypto")
+	if err := e.PreSend(ctx, msg); err != nil {
+		t.Fatalf("PreSend() error = %v", err)
+	}
+	if len(msg.Annotations) != 0 {
+		t.Errorf("flagged message carries annotations %v", msg.Annotations)
+	}
+
+	flags, err := s.GetModerationFlags(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("GetModerationFlags() error = %v", err)
+	}
+	if len(flags) != 0 {
+		t.Fatalf("message was flagged before it was saved")
+	}
+
+	if err := e.PostSend(ctx, msg); err != nil {
+		t.Fatalf("PostSend() error = %v", err)
+	}
+	flags, err = s.GetModerationFlags(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("GetModerationFlags() error = %v", err)
+	}
+	if len(flags) != 1 || flags[0].MessageID != msg.ID || flags[0].Rule != "crypto" {
+		t.Fatalf("GetModerationFlags() = %+v, want one flag by rule crypto", flags)
+	}
+
+	// A message that wasn't flagged records nothing.
+	if err := e.PostSend(ctx, newTestMessage("hello")); err != nil {
+		t.Fatalf("PostSend() error = %v", err)
+	}
+	if flags, _ := s.GetModerationFlags(ctx, 0, 10); len(flags) != 1 {
+		t.Errorf("GetModerationFlags() = %d flags, want 1", len(flags))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	e, s := newTestEngine(t)
+	ctx := context.Background()
+	rules := &models.ModerationRules{
+		DryRun: true,
+		Rules:  []models.ModerationRule{{Type: models.RuleKeyword, Words: []string{"spam"}, Action: models.ActionReject}},
+	}
+	if err := s.SaveModerationRules(ctx, models.GlobalModerationScope, rules); err != nil {
+		t.Fatalf("SaveModerationRules() error = %v", err)
+	}
+
+	if err := e.PreSend(ctx, newTestMessage("spam")); err != nil {
+		t.Errorf("PreSend() error = %v in dry-run mode", err)
+	}
+}
@@ -0,0 +1,293 @@
+package moderation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	maxRules           = 100
+	defaultMuteSeconds = 600
+
+	// maskRune replaces every masked code point, so entity offsets into the
+	// plain text stay valid.
+	maskRune = "•"
+)
+
+var (
+	urlPattern     = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()\[\]]+`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@\w+`)
+)
+
+// ruleSet is the compiled form of models.ModerationRules.
+type ruleSet struct {
+	dryRun   bool
+	rules    []*rule
+	loadedAt time.Time
+}
+
+type rule struct {
+	models.ModerationRule
+	pattern *regexp.Regexp // keyword and regex rules
+	window  time.Duration
+	mute    time.Duration
+}
+
+// Validate reports whether rules can be compiled, so bad configuration is
+// rejected when saved rather than when messages are sent.
+func Validate(rules *models.ModerationRules) error {
+	_, err := compile(rules)
+	return err
+}
+
+func compile(rules *models.ModerationRules) (*ruleSet, error) {
+	if len(rules.Rules) > maxRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", maxRules)
+	}
+
+	set := &ruleSet{dryRun: rules.DryRun, loadedAt: time.Now()}
+	for i, config := range rules.Rules {
+		r, err := compileRule(config)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		set.rules = append(set.rules, r)
+	}
+	return set, nil
+}
+
+func compileRule(config models.ModerationRule) (*rule, error) {
+	r := &rule{ModerationRule: config}
+	if r.Name == "" {
+		r.Name = string(r.Type)
+	}
+
+	switch r.Action {
+	case models.ActionReject, models.ActionFlag:
+	case models.ActionMask:
+		if r.Type != models.RuleKeyword && r.Type != models.RuleRegex && r.Type != models.RuleLink {
+			return nil, fmt.Errorf("mask only applies to keyword, regex and link rules")
+		}
+	case models.ActionMute:
+		if r.MuteSeconds < 0 {
+			return nil, fmt.Errorf("mute_seconds must not be negative")
+		}
+		if r.MuteSeconds == 0 {
+			r.MuteSeconds = defaultMuteSeconds
+		}
+		r.mute = time.Duration(r.MuteSeconds) * time.Second
+	default:
+		return nil, fmt.Errorf("invalid action: %q", r.Action)
+	}
+
+	switch r.Type {
+	case models.RuleKeyword:
+		var words []string
+		for _, word := range r.Words {
+			if word = strings.TrimSpace(word); word != "" {
+				words = append(words, regexp.QuoteMeta(word))
+			}
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("keyword rules need words")
+		}
+		// \b only knows ASCII word characters, so keywords are bounded
+		// explicitly by anything that isn't a letter or digit in any script.
+		r.pattern = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])(` + strings.Join(words, "|") + `)(?:[^\p{L}\p{N}]|$)`)
+
+	case models.RuleRegex:
+		if len(r.Patterns) == 0 {
+			return nil, fmt.Errorf("regex rules need patterns")
+		}
+		for _, pattern := range r.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		pattern, err := regexp.Compile(`(?:` + strings.Join(r.Patterns, `)|(?:`) + `)`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patterns: %w", err)
+		}
+		r.pattern = pattern
+
+	case models.RuleLink:
+		if len(r.AllowDomains) == 0 && len(r.DenyDomains) == 0 {
+			return nil, fmt.Errorf("link rules need allow_domains or deny_domains")
+		}
+		r.AllowDomains = normalizeDomains(r.AllowDomains)
+		r.DenyDomains = normalizeDomains(r.DenyDomains)
+
+	case models.RuleMentions:
+		if r.Max < 0 {
+			return nil, fmt.Errorf("max must not be negative")
+		}
+
+	case models.RuleRepeat:
+		if r.Max < 1 || r.WindowSeconds < 1 {
+			return nil, fmt.Errorf("repeat rules need a positive max and window_seconds")
+		}
+		r.window = time.Duration(r.WindowSeconds) * time.Second
+
+	default:
+		return nil, fmt.Errorf("invalid rule type: %q", r.Type)
+	}
+
+	return r, nil
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+// messageTexts returns the user-visible text of a message.
+func messageTexts(msg *models.Message) []string {
+	texts := []string{msg.PlainText}
+	if msg.Poll != nil {
+		texts = append(texts, msg.Poll.Options...)
+	}
+	return texts
+}
+
+func (r *rule) matchesText(msg *models.Message) bool {
+	for _, text := range messageTexts(msg) {
+		if r.pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) maskText(msg *models.Message) {
+	msg.Content = r.mask(msg.Content)
+	msg.PlainText = r.mask(msg.PlainText)
+	if msg.Poll != nil {
+		msg.Poll.Question = r.mask(msg.Poll.Question)
+		for i, option := range msg.Poll.Options {
+			msg.Poll.Options[i] = r.mask(option)
+		}
+	}
+}
+
+// mask masks every match of the rule's pattern in s.
+func (r *rule) mask(s string) string {
+	if r.Type != models.RuleKeyword {
+		return r.pattern.ReplaceAllStringFunc(s, maskString)
+	}
+
+	// Keyword matches include the characters around the keyword, so only
+	// the keyword itself is masked, and the search resumes right after it
+	// in case the next keyword shares the boundary.
+	var b strings.Builder
+	for start := 0; ; {
+		loc := r.pattern.FindStringSubmatchIndex(s[start:])
+		if loc == nil {
+			b.WriteString(s[start:])
+			return b.String()
+		}
+		b.WriteString(s[start : start+loc[2]])
+		b.WriteString(maskString(s[start+loc[2] : start+loc[3]]))
+		start += loc[3]
+	}
+}
+
+// blockedLinks returns the links in msg whose domain the rule does not allow.
+func (r *rule) blockedLinks(msg *models.Message) []string {
+	var links []string
+	for _, text := range append(messageTexts(msg), msg.Content) {
+		links = append(links, urlPattern.FindAllString(text, -1)...)
+	}
+	for _, entity := range msg.Entities {
+		if entity.URL != "" {
+			links = append(links, entity.URL)
+		}
+	}
+	for _, attachment := range msg.Attachments {
+		links = append(links, attachment.URL)
+	}
+
+	var blocked []string
+	for _, link := range links {
+		if !r.linkAllowed(link) && !slices.Contains(blocked, link) {
+			blocked = append(blocked, link)
+		}
+	}
+	return blocked
+}
+
+func (r *rule) linkAllowed(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if slices.ContainsFunc(r.DenyDomains, func(domain string) bool { return matchesDomain(host, domain) }) {
+		return false
+	}
+	if len(r.AllowDomains) > 0 {
+		return slices.ContainsFunc(r.AllowDomains, func(domain string) bool { return matchesDomain(host, domain) })
+	}
+	return true
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains.
+func matchesDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// maskLinks masks blocked links in the text and drops the link entities and
+// attachments that point to them.
+func maskLinks(msg *models.Message, blocked []string) {
+	for _, link := range blocked {
+		msg.Content = strings.ReplaceAll(msg.Content, link, maskString(link))
+		msg.PlainText = strings.ReplaceAll(msg.PlainText, link, maskString(link))
+	}
+	msg.Entities = slices.DeleteFunc(msg.Entities, func(entity models.MessageEntity) bool {
+		return entity.URL != "" && slices.Contains(blocked, entity.URL)
+	})
+	msg.Attachments = slices.DeleteFunc(msg.Attachments, func(attachment models.Attachment) bool {
+		return slices.Contains(blocked, attachment.URL)
+	})
+}
+
+func countMentions(msg *models.Message) int {
+	return len(mentionPattern.FindAllStringIndex(msg.PlainText, -1))
+}
+
+// fingerprint identifies a message's content for repeat detection,
+// ignoring case and whitespace.
+func fingerprint(msg *models.Message) string {
+	text := strings.ToLower(strings.Join(strings.Fields(msg.PlainText), " "))
+	for _, attachment := range msg.Attachments {
+		text += "\n" + attachment.URL
+	}
+	if text == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func maskString(s string) string {
+	return strings.Repeat(maskRune, utf8.RuneCountInString(s))
+}
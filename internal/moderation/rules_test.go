@@ -0,0 +1,167 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.ModerationRule
+		wantErr bool
+	}{
+		{"keyword", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"spam"}, Action: models.ActionReject}, false},
+		{"keyword without words", models.ModerationRule{Type: models.RuleKeyword, Words: []string{" "}, Action: models.ActionReject}, true},
+		{"invalid regex", models.ModerationRule{Type: models.RuleRegex, Patterns: []string{"("}, Action: models.ActionFlag}, true},
+		{"link without domains", models.ModerationRule{Type: models.RuleLink, Action: models.ActionMask}, true},
+		{"mask mentions", models.ModerationRule{Type: models.RuleMentions, Max: 3, Action: models.ActionMask}, true},
+		{"repeat without window", models.ModerationRule{Type: models.RuleRepeat, Max: 3, Action: models.ActionMute}, true},
+		{"negative mute", models.ModerationRule{Type: models.RuleMentions, Max: 3, Action: models.ActionMute, MuteSeconds: -1}, true},
+		{"unknown action", models.ModerationRule{Type: models.RuleMentions, Max: 3, Action: "ban"}, true},
+		{"unknown type", models.ModerationRule{Type: "sentiment", Action: models.ActionFlag}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&models.ModerationRules{Rules: []models.ModerationRule{tt.rule}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchesText(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  models.ModerationRule
+		text  string
+		match bool
+	}{
+		{"keyword", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"spam"}}, "this is SPAM!", true},
+		{"keyword inside a word", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"spam"}}, "spammer", false},
+		{"keyword next to non-ASCII letters", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"spam"}}, "éspam", false},
+		{"regex", models.ModerationRule{Type: models.RuleRegex, Patterns: []string{`(?i)free\s+crypto`}}, "get FREE  crypto", true},
+		{"regex without match", models.ModerationRule{Type: models.RuleRegex, Patterns: []string{`\d{4}`}}, "123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Action = models.ActionReject
+			r, err := compileRule(tt.rule)
+			if err != nil {
+				t.Fatalf("compileRule() error = %v", err)
+			}
+			if got := r.matchesText(&models.Message{PlainText: tt.text}); got != tt.match {
+				t.Errorf("matchesText(%q) = %v, want %v", tt.text, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.ModerationRule
+		text string
+		want string
+	}{
+		{"keyword keeps its boundaries", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"bad"}}, "a bad, bad day", "a •••, ••• day"},
+		{"adjacent keywords", models.ModerationRule{Type: models.RuleKeyword, Words: []string{"foo", "bar"}}, "foo bar", "••• •••"},
+		{"regex counts code points", models.ModerationRule{Type: models.RuleRegex, Patterns: []string{"héllo"}}, "say héllo", "say •••••"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Action = models.ActionMask
+			r, err := compileRule(tt.rule)
+			if err != nil {
+				t.Fatalf("compileRule() error = %v", err)
+			}
+			if got := r.mask(tt.text); got != tt.want {
+				t.Errorf("mask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockedLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.ModerationRule
+		msg     models.Message
+		blocked int
+	}{
+		{
+			name:    "denied domain and its subdomains",
+			rule:    models.ModerationRule{Type: models.RuleLink, DenyDomains: []string{"evil.com"}},
+			msg:     models.Message{PlainText: "see https://evil.com/x and www.cdn.evil.com"},
+			blocked: 2,
+		},
+		{
+			name:    "lookalike domain isn't a subdomain",
+			rule:    models.ModerationRule{Type: models.RuleLink, DenyDomains: []string{"evil.com"}},
+			msg:     models.Message{PlainText: "see https://notevil.com"},
+			blocked: 0,
+		},
+		{
+			name:    "allow list",
+			rule:    models.ModerationRule{Type: models.RuleLink, AllowDomains: []string{"example.com"}},
+			msg:     models.Message{PlainText: "https://docs.example.com https://other.org"},
+			blocked: 1,
+		},
+		{
+			name: "link entities and attachments",
+			rule: models.ModerationRule{Type: models.RuleLink, DenyDomains: []string{"evil.com"}},
+			msg: models.Message{
+				PlainText:   "docs",
+				Entities:    []models.MessageEntity{{Type: models.EntityLink, Length: 4, URL: "https://evil.com/docs"}},
+				Attachments: []models.Attachment{{URL: "https://files.evil.com/a.png"}},
+			},
+			blocked: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Action = models.ActionMask
+			r, err := compileRule(tt.rule)
+			if err != nil {
+				t.Fatalf("compileRule() error = %v", err)
+			}
+			if got := r.blockedLinks(&tt.msg); len(got) != tt.blocked {
+				t.Errorf("blockedLinks() = %v, want %d links", got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestCountMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"@alice and @bob", 2},
+		{"mail me at me@example.com", 0},
+		{"no mentions", 0},
+	}
+
+	for _, tt := range tests {
+		if got := countMentions(&models.Message{PlainText: tt.text}); got != tt.want {
+			t.Errorf("countMentions(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := fingerprint(&models.Message{PlainText: "Buy  NOW"})
+	b := fingerprint(&models.Message{PlainText: "buy now"})
+	if a == "" || a != b {
+		t.Errorf("fingerprints of messages differing in case and spacing differ: %q, %q", a, b)
+	}
+	if fingerprint(&models.Message{}) != "" {
+		t.Errorf("empty message has a fingerprint")
+	}
+}
@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Providers holds the configured identity providers by name.
+type Providers struct {
+	providers map[string]*Provider
+}
+
+func NewProviders(configs ...ProviderConfig) (*Providers, error) {
+	providers := &Providers{providers: make(map[string]*Provider, len(configs))}
+	for _, config := range configs {
+		if !providerNamePattern.MatchString(config.Name) {
+			return nil, fmt.Errorf("invalid provider name: %q", config.Name)
+		}
+		if _, ok := providers.providers[config.Name]; ok {
+			return nil, fmt.Errorf("provider %s is configured twice", config.Name)
+		}
+		if config.ClientID == "" {
+			return nil, fmt.Errorf("provider %s needs a client ID", config.Name)
+		}
+		for _, rawURL := range []string{config.Issuer, config.RedirectURL} {
+			u, err := url.Parse(rawURL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return nil, fmt.Errorf("provider %s needs absolute issuer and redirect URLs", config.Name)
+			}
+		}
+		providers.providers[config.Name] = NewProvider(config)
+	}
+	return providers, nil
+}
+
+// ProvidersFromEnv reads the providers listed in OIDC_PROVIDERS. For a
+// provider named corp it reads OIDC_CORP_ISSUER, OIDC_CORP_CLIENT_ID,
+// OIDC_CORP_CLIENT_SECRET, OIDC_CORP_REDIRECT_URL and optionally
+// OIDC_CORP_SCOPES (space separated) and OIDC_CORP_LINK_BY_USERNAME.
+func ProvidersFromEnv() (*Providers, error) {
+	var configs []ProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := ProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if value := os.Getenv(prefix + "LINK_BY_USERNAME"); value != "" {
+			linkByUsername, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %sLINK_BY_USERNAME: %w", prefix, err)
+			}
+			config.LinkByUsername = linkByUsername
+		}
+		configs = append(configs, config)
+	}
+	return NewProviders(configs...)
+}
+
+func (p *Providers) Get(name string) (*Provider, error) {
+	provider, ok := p.providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return provider, nil
+}
+
+// Names lists the configured providers in alphabetical order.
+func (p *Providers) Names() []string {
+	names := make([]string, 0, len(p.providers))
+	for name := range p.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewProvidersRejectsBadConfig(t *testing.T) {
+	valid := ProviderConfig{Name: "corp", Issuer: "https://idp.example.com", ClientID: "go-chat", RedirectURL: "https://chat.example.com/callback"}
+
+	tests := []struct {
+		name    string
+		configs func() []ProviderConfig
+	}{
+		{"invalid name", func() []ProviderConfig { c := valid; c.Name = "Corp IdP"; return []ProviderConfig{c} }},
+		{"configured twice", func() []ProviderConfig { return []ProviderConfig{valid, valid} }},
+		{"no client ID", func() []ProviderConfig { c := valid; c.ClientID = ""; return []ProviderConfig{c} }},
+		{"relative issuer", func() []ProviderConfig { c := valid; c.Issuer = "/idp"; return []ProviderConfig{c} }},
+		{"non-HTTP redirect URL", func() []ProviderConfig { c := valid; c.RedirectURL = "javascript:alert(1)"; return []ProviderConfig{c} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewProviders(tt.configs()...); err == nil {
+				t.Errorf("NewProviders() accepted %+v", tt.configs())
+			}
+		})
+	}
+
+	if _, err := NewProviders(valid); err != nil {
+		t.Errorf("NewProviders(valid) error = %v", err)
+	}
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", " corp, my-idp ,")
+	t.Setenv("OIDC_CORP_ISSUER", "https://corp.example.com")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "go-chat")
+	t.Setenv("OIDC_CORP_REDIRECT_URL", "https://chat.example.com/corp")
+	t.Setenv("OIDC_CORP_LINK_BY_USERNAME", "true")
+	t.Setenv("OIDC_MY_IDP_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_MY_IDP_CLIENT_ID", "go-chat")
+	t.Setenv("OIDC_MY_IDP_REDIRECT_URL", "https://chat.example.com/my-idp")
+	t.Setenv("OIDC_MY_IDP_SCOPES", "openid email")
+
+	providers, err := ProvidersFromEnv()
+	if err != nil {
+		t.Fatalf("ProvidersFromEnv() error = %v", err)
+	}
+	if names := providers.Names(); !reflect.DeepEqual(names, []string{"corp", "my-idp"}) {
+		t.Errorf("Names() = %v", names)
+	}
+
+	corp, err := providers.Get("corp")
+	if err != nil || !corp.LinkByUsername() {
+		t.Errorf("corp = %+v, %v; want linking by username", corp, err)
+	}
+	myIdP, err := providers.Get("my-idp")
+	if err != nil || !reflect.DeepEqual(myIdP.config.Scopes, []string{"openid", "email"}) {
+		t.Errorf("my-idp = %+v, %v; want the configured scopes", myIdP, err)
+	}
+	if _, err := providers.Get("other"); err != ErrProviderNotFound {
+		t.Errorf("Get(other) error = %v, want %v", err, ErrProviderNotFound)
+	}
+
+	t.Setenv("OIDC_CORP_LINK_BY_USERNAME", "sometimes")
+	if _, err := ProvidersFromEnv(); err == nil {
+		t.Errorf("ProvidersFromEnv() accepted an invalid OIDC_CORP_LINK_BY_USERNAME")
+	}
+}
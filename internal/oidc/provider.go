@@ -0,0 +1,307 @@
+// Package oidc signs users in with OpenID Connect providers using the
+// authorization code flow with PKCE. It discovers each provider's endpoints
+// from its issuer URL and verifies ID tokens against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bm-197/go-chat/internal/keys"
+)
+
+const (
+	httpTimeout = 10 * time.Second
+	// jwksMissRefresh limits JWKS reloads caused by ID tokens with unknown
+	// key IDs.
+	jwksMissRefresh = time.Minute
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrProviderNotFound = errors.New("unknown identity provider")
+	ErrInvalidIDToken   = errors.New("invalid ID token")
+)
+
+type ProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Empty for public clients
+	RedirectURL  string
+	Scopes       []string
+	// LinkByUsername signs a provider account in as the existing user with
+	// the same username the first time it is used. Only enable it for
+	// providers that own the usernames, such as the company directory.
+	LinkByUsername bool
+}
+
+// Claims are the parts of an ID token used to find or create the user.
+type Claims struct {
+	Provider          string `json:"-"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// discovery is the subset of the provider metadata (OpenID Connect
+// Discovery 1.0) the flow needs.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *discovery
+	keys        map[string]keys.JWK
+	refreshedAt time.Time
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) LinkByUsername() bool {
+	return p.config.LinkByUsername
+}
+
+// AuthCodeURL returns the provider URL the user signs in at. The verifier
+// is kept until the callback and its S256 challenge is sent now.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token that comes with it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("failed to redeem authorization code: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing from token response", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, metadata, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, metadata *discovery, idToken, nonce string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(idToken, &claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, metadata, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	claims.Provider = p.config.Name
+	return &claims, nil
+}
+
+// key returns the provider key an ID token names, reloading the JWKS when
+// the provider has rotated to a key we haven't seen.
+func (p *Provider) key(ctx context.Context, metadata *discovery, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	jwk, ok := p.findKey(kid)
+	if !ok && time.Since(p.refreshedAt) > jwksMissRefresh {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		var set keys.JWKSet
+		status, err := p.do(req, &set)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch provider keys: status %d", status)
+		}
+
+		p.keys = make(map[string]keys.JWK, len(set.Keys))
+		for _, k := range set.Keys {
+			if k.Use == "" || k.Use == "sig" {
+				p.keys[k.KeyID] = k
+			}
+		}
+		p.refreshedAt = time.Now()
+		jwk, ok = p.findKey(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown provider key: %q", kid)
+	}
+	return jwk.PublicKey()
+}
+
+// findKey looks a key up by ID. Tokens without a kid may use the provider's
+// only key.
+func (p *Provider) findKey(kid string) (keys.JWK, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+// discover fetches the provider metadata once and keeps it.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(p.config.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata discovery
+	status, err := p.do(req, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover provider %s: %w", p.config.Name, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover provider %s: status %d", p.config.Name, status)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("provider %s reports issuer %q", p.config.Name, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("provider %s metadata is incomplete", p.config.Name)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// do sends req and decodes the JSON response into v, returning the status.
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// RandomString returns a URL-safe random string for states, nonces and
+// code verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from a code verifier
+// (RFC 7636).
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,295 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bm-197/go-chat/internal/keys"
+)
+
+const (
+	testClientID     = "go-chat"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://chat.example.com/callback"
+)
+
+// testIdP is an identity provider that issues an ID token for any code
+// AuthCodeURL led to.
+type testIdP struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	key        *ecdsa.PrivateKey
+	kid        string
+	challenges map[string]string // Code to PKCE challenge
+	claims     func(jwt.MapClaims)
+	jwksLoads  int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	idp := &testIdP{challenges: make(map[string]string)}
+	idp.rotate(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksLoads++
+		jwk, _ := keys.NewJWK(idp.kid, "ES256", &idp.key.PublicKey)
+		json.NewEncoder(w).Encode(keys.JWKSet{Keys: []keys.JWK{jwk}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// rotate switches the provider to a new signing key.
+func (idp *testIdP) rotate(t *testing.T) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	kid, err := RandomString()
+	if err != nil {
+		t.Fatalf("RandomString() error = %v", err)
+	}
+	idp.mu.Lock()
+	idp.key, idp.kid = key, kid
+	idp.mu.Unlock()
+}
+
+// authorize plays the user signing in at authURL and returns the code the
+// provider redirects back with.
+func (idp *testIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	code, err := RandomString()
+	if err != nil {
+		t.Fatalf("RandomString() error = %v", err)
+	}
+	idp.mu.Lock()
+	idp.challenges[code] = u.Query().Get("code_challenge") + " " + u.Query().Get("nonce")
+	idp.mu.Unlock()
+	return code
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if clientID, secret, ok := r.BasicAuth(); !ok || clientID != testClientID || secret != testClientSecret {
+		fail("invalid_client")
+		return
+	}
+	grant, ok := idp.challenges[r.PostFormValue("code")]
+	delete(idp.challenges, r.PostFormValue("code"))
+	challenge, nonce, _ := strings.Cut(grant, " ")
+	if !ok || r.PostFormValue("redirect_uri") != testRedirectURL || CodeChallenge(r.PostFormValue("code_verifier")) != challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = idp.kid
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func newTestProvider(idp *testIdP) *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "test",
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+// signIn runs the authorization code flow against idp.
+func signIn(t *testing.T, provider *Provider, idp *testIdP) (*Claims, error) {
+	t.Helper()
+
+	verifier, _ := RandomString()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	return provider.Exchange(context.Background(), idp.authorize(t, authURL), verifier, "nonce")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestProvider(idp)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        CodeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Errorf("AuthCodeURL() = %s, want the discovered authorization endpoint", authURL)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestProvider(idp)
+
+	claims, err := signIn(t, provider, idp)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if claims.Provider != "test" || claims.Subject != "user-1" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("Exchange() = %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestProvider(idp)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), idp.authorize(t, authURL), "other", "nonce"); err == nil {
+		t.Errorf("Exchange() with the wrong code verifier succeeded")
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+	}{
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"other nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			idp.claims = tt.claims
+			if _, err := signIn(t, newTestProvider(idp), idp); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange() error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestExchangeReloadsRotatedKeys(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestProvider(idp)
+
+	if _, err := signIn(t, provider, idp); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// Keys the provider hasn't published yet can't force a reload on every
+	// sign-in.
+	idp.rotate(t)
+	if _, err := signIn(t, provider, idp); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() within %s of the last reload error = %v, want %v", jwksMissRefresh, err, ErrInvalidIDToken)
+	}
+
+	provider.mu.Lock()
+	provider.refreshedAt = time.Now().Add(-jwksMissRefresh)
+	provider.mu.Unlock()
+	if _, err := signIn(t, provider, idp); err != nil {
+		t.Errorf("Exchange() after the provider rotated error = %v", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	if idp.jwksLoads != 2 {
+		t.Errorf("JWKS loaded %d times, want 2", idp.jwksLoads)
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	// The metadata names another issuer than the one it is served for.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/authorize",
+			"token_endpoint":         "https://evil.example.com/token",
+			"jwks_uri":               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewProvider(ProviderConfig{Name: "test", Issuer: server.URL, ClientID: testClientID, RedirectURL: testRedirectURL})
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Errorf("AuthCodeURL() accepted metadata for another issuer")
+	}
+}
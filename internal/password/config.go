@@ -0,0 +1,59 @@
+package password
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const defaultMinLength = 8
+
+// ManagerFromEnv configures password hashing and policy from
+// PASSWORD_HASH (bcrypt or argon2id), PASSWORD_BCRYPT_COST,
+// PASSWORD_ARGON2_TIME, PASSWORD_ARGON2_MEMORY (KiB),
+// PASSWORD_ARGON2_THREADS, PASSWORD_MIN_LENGTH and PASSWORD_BREACHED_LIST
+// (a file path). Unset values keep their defaults.
+func ManagerFromEnv() (*Manager, error) {
+	config := DefaultConfig
+	if algorithm := os.Getenv("PASSWORD_HASH"); algorithm != "" {
+		config.Algorithm = algorithm
+	}
+
+	argon2Threads := uint32(config.Argon2.Threads)
+	minLength := defaultMinLength
+	for name, target := range map[string]any{
+		"PASSWORD_BCRYPT_COST":    &config.BcryptCost,
+		"PASSWORD_ARGON2_TIME":    &config.Argon2.Time,
+		"PASSWORD_ARGON2_MEMORY":  &config.Argon2.Memory,
+		"PASSWORD_ARGON2_THREADS": &argon2Threads,
+		"PASSWORD_MIN_LENGTH":     &minLength,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		switch target := target.(type) {
+		case *int:
+			*target = int(n)
+		case *uint32:
+			*target = uint32(n)
+		}
+	}
+	if argon2Threads > 255 {
+		return nil, fmt.Errorf("invalid PASSWORD_ARGON2_THREADS: at most 255")
+	}
+	config.Argon2.Threads = uint8(argon2Threads)
+
+	policy := NewPolicy(minLength)
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if err := policy.LoadBreachedList(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewManager(config, policy)
+}
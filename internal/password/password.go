@@ -0,0 +1,199 @@
+// Package password hashes, verifies and vets user passwords. Hashes are
+// self-describing, so passwords hashed with an older algorithm or cost keep
+// working and are rehashed with the current settings at the next login.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+)
+
+var errUnknownHash = errors.New("unrecognized password hash")
+
+// Argon2Params are the argon2id cost parameters (RFC 9106).
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+type Config struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultConfig is bcrypt at the cost users were always hashed with, and
+// the RFC 9106 second recommended option for argon2id.
+var DefaultConfig = Config{
+	Algorithm:  AlgBcrypt,
+	BcryptCost: bcrypt.DefaultCost + 2,
+	Argon2: Argon2Params{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	},
+}
+
+// Manager hashes passwords with the configured algorithm and checks new
+// passwords against the policy.
+type Manager struct {
+	config Config
+	policy *Policy
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+func NewManager(config Config, policy *Policy) (*Manager, error) {
+	switch config.Algorithm {
+	case AlgBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgArgon2id:
+		if config.Argon2.Time < 1 || config.Argon2.Memory < 8*uint32(config.Argon2.Threads) || config.Argon2.Threads < 1 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash: %q", config.Algorithm)
+	}
+
+	return &Manager{
+		config: config,
+		policy: policy,
+	}, nil
+}
+
+// Validate checks a new password against the policy.
+func (m *Manager) Validate(password, username string) error {
+	return m.policy.Validate(password, username)
+}
+
+// Hash hashes a password with the configured algorithm.
+func (m *Manager) Hash(password string) (string, error) {
+	if m.config.Algorithm == AlgArgon2id {
+		return hashArgon2id(password, m.config.Argon2)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), m.config.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches hash, whichever supported
+// algorithm made it.
+func Verify(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	return false
+}
+
+// NeedsRehash reports whether hash was made with other settings than the
+// configured ones.
+func (m *Manager) NeedsRehash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		if m.config.Algorithm != AlgArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil || params != m.config.Argon2
+	case strings.HasPrefix(hash, "$2"):
+		if m.config.Algorithm != AlgBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != m.config.BcryptCost
+	}
+	return true
+}
+
+// Simulate does the work of verifying a password when there is no hash to
+// verify it against, so failures take as long for unknown users as for
+// wrong passwords.
+func (m *Manager) Simulate(password string) {
+	m.dummyHashOnce.Do(func() {
+		m.dummyHash, _ = m.Hash("dummy password")
+	})
+	Verify(m.dummyHash, password)
+}
+
+// hashArgon2id encodes the hash in the PHC string format used by the
+// reference implementation.
+func hashArgon2id(password string, params Argon2Params) (string, error) {
+	salt, err := randomBytes(argon2SaltBytes)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, argon2KeyBytes)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return params, nil, nil, errUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errUnknownHash
+	}
+	if params.Time < 1 || params.Threads < 1 {
+		return params, nil, nil, errUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errUnknownHash
+	}
+	return params, salt, key, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
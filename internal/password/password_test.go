@@ -0,0 +1,111 @@
+package password
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastConfig keeps hashing cheap in tests.
+var fastConfig = Config{
+	Algorithm:  AlgBcrypt,
+	BcryptCost: bcrypt.MinCost,
+	Argon2:     Argon2Params{Time: 1, Memory: 64, Threads: 1},
+}
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgBcrypt, AlgArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			config := fastConfig
+			config.Algorithm = algorithm
+			m, err := NewManager(config, NewPolicy(defaultMinLength))
+			if err != nil {
+				t.Fatalf("NewManager() error = %v", err)
+			}
+
+			hash, err := m.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if !Verify(hash, "correct horse") {
+				t.Errorf("Verify() rejects the right password")
+			}
+			if Verify(hash, "wrong horse") {
+				t.Errorf("Verify() accepts a wrong password")
+			}
+			if m.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash() = true for a hash with the current settings")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsUnknownHashes(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$garbage", "$2a$garbage"} {
+		if Verify(hash, "plaintext") {
+			t.Errorf("Verify(%q) = true", hash)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptManager, err := NewManager(fastConfig, NewPolicy(defaultMinLength))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	argon2Config := fastConfig
+	argon2Config.Algorithm = AlgArgon2id
+	argon2Manager, err := NewManager(argon2Config, NewPolicy(defaultMinLength))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	bcryptHash, _ := bcryptManager.Hash("correct horse")
+	argon2Hash, _ := argon2Manager.Hash("correct horse")
+	costlier, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost+1)
+	stronger := argon2Config
+	stronger.Argon2.Time++
+	strongerManager, _ := NewManager(stronger, NewPolicy(defaultMinLength))
+
+	tests := []struct {
+		name    string
+		manager *Manager
+		hash    string
+		want    bool
+	}{
+		{"bcrypt to argon2id", argon2Manager, bcryptHash, true},
+		{"argon2id to bcrypt", bcryptManager, argon2Hash, true},
+		{"bcrypt cost changed", bcryptManager, string(costlier), true},
+		{"argon2id parameters changed", strongerManager, argon2Hash, true},
+		{"unknown hash", bcryptManager, "plaintext", true},
+		{"current bcrypt", bcryptManager, bcryptHash, false},
+		{"current argon2id", argon2Manager, argon2Hash, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.manager.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewManagerRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"unknown algorithm", Config{Algorithm: "md5"}},
+		{"bcrypt cost too low", Config{Algorithm: AlgBcrypt, BcryptCost: bcrypt.MinCost - 1}},
+		{"argon2id without threads", Config{Algorithm: AlgArgon2id, Argon2: Argon2Params{Time: 1, Memory: 64}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewManager(tt.config, NewPolicy(defaultMinLength)); err == nil {
+				t.Errorf("NewManager() accepted %+v", tt.config)
+			}
+		})
+	}
+}
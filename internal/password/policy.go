@@ -0,0 +1,94 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxBytes is bcrypt's input limit; longer passwords would be truncated.
+const maxBytes = 72
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	ErrBreached = errors.New("password appears in a list of breached passwords")
+	ErrUsername = errors.New("password must not be the username")
+)
+
+// Policy is what new passwords must satisfy.
+type Policy struct {
+	MinLength int // In characters
+	// breached holds the uppercase hex SHA-1 of known breached passwords.
+	breached map[string]struct{}
+}
+
+func NewPolicy(minLength int) *Policy {
+	return &Policy{
+		MinLength: minLength,
+		breached:  make(map[string]struct{}),
+	}
+}
+
+// LoadBreachedList adds a file of breached passwords to the policy. Each
+// line is either a password or the SHA-1 of one in the Have I Been Pwned
+// format (HASH or HASH:COUNT).
+func (p *Policy) LoadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return nil
+}
+
+// Validate returns the first rule password breaks, if any.
+func (p *Policy) Validate(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrTooShort, p.MinLength)
+	}
+	if len(password) > maxBytes {
+		return fmt.Errorf("%w: use at most %d bytes", ErrTooLong, maxBytes)
+	}
+	if strings.EqualFold(password, username) {
+		return ErrUsername
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return ErrBreached
+	}
+	return nil
+}
+
+func isSHA1(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,61 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := NewPolicy(8)
+	policy.breached[sha1Hex("password123")] = struct{}{}
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"ok", "correct horse", nil},
+		{"too short", "short", ErrTooShort},
+		{"length counts characters", "pässwörd", nil},
+		{"too long", strings.Repeat("a", maxBytes+1), ErrTooLong},
+		{"username", "Alice-Smith", ErrUsername},
+		{"breached", "password123", ErrBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "alice-smith")
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%q) error = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "hunter2hunter2\n\n" + strings.ToLower(sha1Hex("letmein123")) + ":42\n" + sha1Hex("qwertyuiop") + "\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := NewPolicy(8)
+	if err := policy.LoadBreachedList(path); err != nil {
+		t.Fatalf("LoadBreachedList() error = %v", err)
+	}
+	for _, pw := range []string{"hunter2hunter2", "letmein123", "qwertyuiop"} {
+		if err := policy.Validate(pw, "alice"); !errors.Is(err, ErrBreached) {
+			t.Errorf("Validate(%q) error = %v, want %v", pw, err, ErrBreached)
+		}
+	}
+	if err := policy.Validate("correct horse", "alice"); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if err := policy.LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("LoadBreachedList() accepted a missing file")
+	}
+}
@@ -0,0 +1,85 @@
+// Package plugin lets custom Go code hook into the message pipeline without
+// forking the server.
+//
+// A plugin implements Plugin plus any of PreSendHook, PostSendHook and
+// PreDeliverHook, and is registered on a Registry at startup:
+//
+//   - PreSend runs once a message has been validated and authorized, right
+//     before it is saved (or scheduled). Hooks may modify the message, add
+//     Annotations, or reject it. If hooks change Content but not PlainText,
+//     PlainText and Entities are parsed again from the new Content, which
+//     can reject the message. The first hook to return an error stops the
+//     send: a *RejectError is reported to the sender as a rejection, any
+//     other error as an internal failure. Nothing is stored in either case.
+//   - PostSend runs after the message has been saved and published. It
+//     cannot affect the send; errors and panics are logged.
+//   - PreDeliver runs on every node for each recipient socket just before a
+//     pub/sub payload is written to it. Hooks may modify Delivery.Message or,
+//     for events, Delivery.Payload. Returning ErrDrop skips the delivery
+//     silently; any other error is logged and also skips it, so a failing
+//     redaction hook never leaks the original payload.
+//
+// Hooks run in ascending priority, then in registration order. A panicking
+// hook is treated as returning an error.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+// ErrDrop tells the registry to skip a delivery without logging.
+var ErrDrop = errors.New("delivery dropped")
+
+type Plugin interface {
+	Name() string
+}
+
+type PreSendHook interface {
+	PreSend(ctx context.Context, msg *models.Message) error
+}
+
+type PostSendHook interface {
+	PostSend(ctx context.Context, msg *models.Message) error
+}
+
+type PreDeliverHook interface {
+	PreDeliver(ctx context.Context, delivery *Delivery) error
+}
+
+// Delivery is a pub/sub payload about to be written to one recipient.
+type Delivery struct {
+	RecipientID string
+	Channel     string
+	// Message is the decoded payload when it is a chat message, and nil for
+	// events. Changes to it are re-encoded before writing.
+	Message *models.Message
+	Payload []byte
+}
+
+// RejectError rejects a message in PreSend with a reason shown to the sender.
+type RejectError struct {
+	Plugin string
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return e.Reason
+}
+
+func Reject(plugin, reason string) error {
+	return &RejectError{Plugin: plugin, Reason: reason}
+}
+
+// call runs fn, turning a panic into an error.
+func call(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin %s panicked: %v", name, r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+type registration struct {
+	plugin   Plugin
+	priority int
+}
+
+// Registry holds the registered plugins. A nil *Registry has no plugins, so
+// callers never need to check for one.
+type Registry struct {
+	mu      sync.RWMutex
+	plugins []registration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a plugin. Lower priorities run first; plugins with equal
+// priority run in registration order.
+func (r *Registry) Register(p Plugin, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Hooks may be iterating over the current slice, so build a new one.
+	plugins := append(slices.Clone(r.plugins), registration{plugin: p, priority: priority})
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return plugins[i].priority < plugins[j].priority
+	})
+	r.plugins = plugins
+}
+
+func (r *Registry) snapshot() []registration {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.plugins
+}
+
+// PreSend runs the PreSend hooks in order and stops at the first error.
+func (r *Registry) PreSend(ctx context.Context, msg *models.Message) error {
+	for _, reg := range r.snapshot() {
+		hook, ok := reg.plugin.(PreSendHook)
+		if !ok {
+			continue
+		}
+		if err := call(reg.plugin.Name(), func() error { return hook.PreSend(ctx, msg) }); err != nil {
+			var rejection *RejectError
+			if errors.As(err, &rejection) && rejection.Plugin == "" {
+				rejection.Plugin = reg.plugin.Name()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// PostSend runs every PostSend hook, logging failures.
+func (r *Registry) PostSend(ctx context.Context, msg *models.Message) {
+	for _, reg := range r.snapshot() {
+		hook, ok := reg.plugin.(PostSendHook)
+		if !ok {
+			continue
+		}
+		if err := call(reg.plugin.Name(), func() error { return hook.PostSend(ctx, msg) }); err != nil {
+			log.Printf("plugin %s post-send failed for message %s: %v", reg.plugin.Name(), msg.ID, err)
+		}
+	}
+}
+
+// PreDeliver runs the PreDeliver hooks for one recipient and returns the
+// payload to write, or false when the delivery must be skipped.
+func (r *Registry) PreDeliver(ctx context.Context, recipientID, channel string, payload []byte) ([]byte, bool) {
+	plugins := r.snapshot()
+	if len(plugins) == 0 {
+		return payload, true
+	}
+
+	delivery := &Delivery{
+		RecipientID: recipientID,
+		Channel:     channel,
+		Payload:     payload,
+	}
+	delivery.Message = decodeMessage(payload)
+
+	hooked := false
+	for _, reg := range plugins {
+		hook, ok := reg.plugin.(PreDeliverHook)
+		if !ok {
+			continue
+		}
+		hooked = true
+		if err := call(reg.plugin.Name(), func() error { return hook.PreDeliver(ctx, delivery) }); err != nil {
+			if !errors.Is(err, ErrDrop) {
+				log.Printf("plugin %s pre-deliver failed for %s: %v", reg.plugin.Name(), recipientID, err)
+			}
+			return nil, false
+		}
+	}
+	if !hooked || delivery.Message == nil {
+		return delivery.Payload, true
+	}
+
+	data, err := json.Marshal(delivery.Message)
+	if err != nil {
+		log.Printf("failed to encode delivery for %s: %v", recipientID, err)
+		return nil, false
+	}
+	return data, true
+}
+
+// decodeMessage returns the payload as a message, or nil for events.
+func decodeMessage(payload []byte) *models.Message {
+	var probe struct {
+		Type models.MessageType `json:"type"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil || !probe.Type.IsValid() {
+		return nil
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil
+	}
+	return &msg
+}
@@ -0,0 +1,49 @@
+// Package ratelimit throttles clients with token buckets kept in Redis, so
+// limits hold across every server node.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// Limit allows bursts of up to Burst requests, refilling fully over Period.
+type Limit struct {
+	Name   string
+	Burst  int
+	Period time.Duration
+}
+
+var (
+	// Auth guards login and registration, per IP.
+	Auth = Limit{Name: "auth", Burst: 10, Period: time.Minute}
+	// Send guards sending messages, polls and votes over HTTP and WebSocket,
+	// per user. It sustains one message a second.
+	Send = Limit{Name: "send", Burst: 20, Period: 20 * time.Second}
+	// History guards reading history, search, pins and stars, per user.
+	History = Limit{Name: "history", Burst: 60, Period: time.Minute}
+)
+
+type Limiter struct {
+	store *store.RedisStore
+}
+
+func NewLimiter(store *store.RedisStore) *Limiter {
+	return &Limiter{
+		store: store,
+	}
+}
+
+// Allow takes one request from subject's budget under limit.
+func (l *Limiter) Allow(ctx context.Context, limit Limit, subject string) (*store.RateLimitResult, error) {
+	return l.store.TakeToken(ctx, fmt.Sprintf("%s:%s", limit.Name, subject), limit.Burst, limit.Period)
+}
+
+// Seconds rounds d up to whole seconds, as Retry-After expects.
+func Seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
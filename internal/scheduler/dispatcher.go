@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/service"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	batchSize = 100
+
+	// Failed deliveries are retried with exponential backoff, up to
+	// maxDeliveryAttempts times.
+	maxDeliveryAttempts = 10
+	retryBaseDelay      = 5 * time.Second
+	maxRetryDelay       = 10 * time.Minute
+)
+
+// Dispatcher periodically claims due scheduled messages and sends them. Every
+// server node may run one; claiming is atomic in Redis, so each message is
+// delivered by a single node.
+type Dispatcher struct {
+	store    *store.RedisStore
+	service  *service.MessageService
+	interval time.Duration
+}
+
+func NewDispatcher(store *store.RedisStore, service *service.MessageService, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		service:  service,
+		interval: interval,
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatchDue(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	for {
+		messages, err := d.store.ClaimDueMessages(ctx, time.Now(), batchSize)
+		if err != nil {
+			log.Printf("failed to claim scheduled messages: %v", err)
+			return
+		}
+
+		failed := false
+		for _, msg := range messages {
+			if !d.send(ctx, msg) {
+				failed = true
+			}
+		}
+
+		// After a failure, wait for the next tick rather than hammer a
+		// struggling dependency.
+		if failed || len(messages) < batchSize {
+			return
+		}
+	}
+}
+
+// send delivers a claimed message and reports whether delivery went
+// through or was refused for good. Other failures are retried later.
+func (d *Dispatcher) send(ctx context.Context, msg *store.ClaimedMessage) bool {
+	err := d.service.DeliverScheduled(ctx, msg.Message)
+	if err == nil {
+		return true
+	}
+
+	var serviceErr *service.Error
+	if errors.As(err, &serviceErr) {
+		log.Printf("dropping scheduled message %s: %v", msg.ID, err)
+		return true
+	}
+
+	attempts := msg.Attempts + 1
+	if attempts >= maxDeliveryAttempts {
+		log.Printf("dropping scheduled message %s after %d failed deliveries: %v", msg.ID, attempts, err)
+		return false
+	}
+
+	delay := retryDelay(attempts)
+	log.Printf("failed to deliver scheduled message %s, retrying in %s: %v", msg.ID, delay, err)
+	if err := d.store.RetryScheduledMessage(ctx, msg.Message, attempts, time.Now().Add(delay)); err != nil {
+		log.Printf("failed to reschedule message %s: %v", msg.ID, err)
+	}
+	return false
+}
+
+// retryDelay is how long to wait before the next delivery after attempts
+// failed ones.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
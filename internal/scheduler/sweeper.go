@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// Sweeper periodically purges disappearing messages once they expire and
+// tells connected clients to drop them.
+type Sweeper struct {
+	store    *store.RedisStore
+	interval time.Duration
+}
+
+func NewSweeper(store *store.RedisStore, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		store:    store,
+		interval: interval,
+	}
+}
+
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *Sweeper) sweep(ctx context.Context) {
+	for {
+		messages, err := s.store.PurgeExpiredMessages(ctx, time.Now(), batchSize)
+		if err != nil {
+			log.Printf("failed to purge expired messages: %v", err)
+			return
+		}
+
+		for _, msg := range messages {
+			event := models.NewEvent(models.EventMessageExpired, msg.ConversationID(), "")
+			event.MessageID = msg.ID
+			if err := s.store.PublishEvent(ctx, event); err != nil {
+				log.Printf("failed to publish expiry of message %s: %v", msg.ID, err)
+			}
+		}
+
+		if len(messages) < batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const minTokenLength = 2
+
+// Tokenize splits text into lowercase words made of letters and digits and
+// returns each distinct word once, in order of first appearance. It is used
+// both to index messages and to parse queries, so the two always agree.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) < minTokenLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// MessageTokens returns the searchable words of a message: its text without
+// Markdown, poll options and attachment names.
+func MessageTokens(msg *models.Message) []string {
+	parts := []string{msg.PlainText}
+	if msg.PlainText == "" {
+		parts[0] = msg.Content
+	}
+	if msg.Poll != nil {
+		parts = append(parts, msg.Poll.Options...)
+	}
+	for _, attachment := range msg.Attachments {
+		parts = append(parts, attachment.Name)
+	}
+	return Tokenize(strings.Join(parts, " "))
+}
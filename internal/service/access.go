@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+// CanReadMessage reports whether userID may see msg: participants of a
+// private chat, current members of a group, and anyone for broadcasts.
+func CanReadMessage(ctx context.Context, s *store.RedisStore, userID string, msg *models.Message) (bool, error) {
+	switch msg.Type {
+	case models.MessageTypePrivate:
+		return msg.FromID == userID || msg.ToID == userID, nil
+	case models.MessageTypeGroup:
+		group, err := s.GetGroup(ctx, msg.GroupID)
+		if errors.Is(err, store.ErrGroupNotFound) {
+			// A deleted group's history is no longer readable.
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return group.IsMember(userID), nil
+	default:
+		return true, nil
+	}
+}
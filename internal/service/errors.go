@@ -0,0 +1,40 @@
+package service
+
+import "fmt"
+
+type ErrorKind int
+
+const (
+	KindInvalid ErrorKind = iota + 1
+	KindNotFound
+	KindForbidden
+	KindConflict
+	KindRejected
+)
+
+// Error is a failure the client can act on. Transports map its Kind to their
+// own status codes; any other error from the service is internal.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalidf(format string, args ...any) error {
+	return &Error{Kind: KindInvalid, Message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(message string) error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func forbidden(message string) error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+func conflict(message string) error {
+	return &Error{Kind: KindConflict, Message: message}
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/markup"
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/plugin"
+	"github.com/bm-197/go-chat/internal/store"
+)
+
+const (
+	maxAttachments = 10
+	minPollOptions = 2
+	maxPollOptions = 10
+
+	// IdempotencyWindow is how long a client_msg_id or Idempotency-Key is
+	// remembered for deduplicating retried sends.
+	IdempotencyWindow = 24 * time.Hour
+)
+
+// SendFunc persists and publishes a prepared message.
+type SendFunc func(ctx context.Context, msg *models.Message) error
+
+// Middleware wraps the send path. A middleware may inspect or modify the
+// message, reject it by returning an error without calling next, or run code
+// after next returns. Middleware runs for every send, forward and poll,
+// whatever the transport, once the message is validated and authorized, and
+// before plugin PreSend hooks.
+type Middleware func(next SendFunc) SendFunc
+
+// SendRequest is a transport-independent request to send a message.
+type SendRequest struct {
+	Type        models.MessageType
+	Content     string
+	ToUserID    string // Private recipient by user ID
+	ToUsername  string // Private recipient by username, used when ToUserID is empty
+	GroupID     string
+	Attachments []models.Attachment
+	Poll        *models.Poll
+	SendAt      *time.Time
+	ClientMsgID string
+	// IdempotencyKey dedupes retries and defaults to ClientMsgID.
+	IdempotencyKey string
+}
+
+// ForwardRequest forwards MessageID to a private chat or group.
+type ForwardRequest struct {
+	MessageID  string
+	Type       models.MessageType
+	ToUserID   string
+	ToUsername string
+	GroupID    string
+}
+
+type SendResult struct {
+	Message   *models.Message
+	Scheduled bool
+	Duplicate bool // An earlier send with the same idempotency key won
+}
+
+// MessageService owns sending messages: validation, authorization,
+// persistence and publication. HTTP and WebSocket handlers both go through
+// it so every transport enforces the same rules.
+type MessageService struct {
+	store      *store.RedisStore
+	plugins    *plugin.Registry
+	middleware []Middleware
+}
+
+func NewMessageService(store *store.RedisStore, plugins *plugin.Registry) *MessageService {
+	return &MessageService{
+		store:   store,
+		plugins: plugins,
+	}
+}
+
+// Use appends middleware to the send path. The first middleware added is the
+// outermost. Use must be called before the service starts handling sends.
+func (s *MessageService) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+func (s *MessageService) Send(ctx context.Context, senderID, senderName string, req SendRequest) (*SendResult, error) {
+	sender, err := s.checkSender(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBot(sender, req.Type); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.prepare(ctx, senderID, senderName, req)
+	if err != nil {
+		return nil, err
+	}
+	msg.FromBot = sender.IsBot
+
+	key := req.IdempotencyKey
+	if key == "" {
+		key = req.ClientMsgID
+	}
+	var token string
+	if key != "" {
+		var existing *models.Message
+		existing, token, err = s.store.ReserveIdempotencyKey(ctx, senderID, key)
+		if err != nil {
+			if errors.Is(err, store.ErrSendInProgress) {
+				return nil, conflict(err.Error())
+			}
+			return nil, err
+		}
+		if existing != nil {
+			return &SendResult{Message: existing, Duplicate: true}, nil
+		}
+	}
+
+	err = s.send(ctx, msg)
+	if key != "" {
+		s.finishIdempotentSend(ctx, senderID, key, token, msg, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendResult{Message: msg, Scheduled: msg.SendAt != nil}, nil
+}
+
+// Forward sends a copy of a message the sender can read to another
+// conversation, keeping a reference to the original.
+func (s *MessageService) Forward(ctx context.Context, senderID, senderName string, req ForwardRequest) (*models.Message, error) {
+	if req.Type != models.MessageTypePrivate && req.Type != models.MessageTypeGroup {
+		return nil, invalidf("messages can only be forwarded to a user or group")
+	}
+	sender, err := s.checkSender(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := s.store.GetMessage(ctx, req.MessageID)
+	if err != nil {
+		if errors.Is(err, store.ErrMessageNotFound) {
+			return nil, notFound("message not found")
+		}
+		return nil, err
+	}
+	canRead, err := CanReadMessage(ctx, s.store, senderID, original)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead {
+		return nil, notFound("message not found")
+	}
+
+	msg := original.Forward(req.Type, senderID, senderName)
+	msg.FromBot = sender.IsBot
+	if err := s.setRecipient(ctx, msg, req.ToUserID, req.ToUsername, req.GroupID); err != nil {
+		return nil, err
+	}
+
+	if err := s.send(ctx, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DeliverScheduled sends a scheduled message that has come due. The sender's
+// account status, permissions and group membership are checked again since
+// they may have changed.
+func (s *MessageService) DeliverScheduled(ctx context.Context, msg *models.Message) error {
+	sender, err := s.checkSender(ctx, msg.FromID)
+	if err != nil {
+		return err
+	}
+	if err := checkBot(sender, msg.Type); err != nil {
+		return err
+	}
+	if msg.Type == models.MessageTypeGroup {
+		group, err := s.store.GetGroup(ctx, msg.GroupID)
+		if err != nil || !group.IsMember(msg.FromID) {
+			return forbidden("sender is no longer a member of the group")
+		}
+	}
+
+	msg.Timestamp = time.Now()
+	return s.deliver(ctx, msg)
+}
+
+// checkSender returns the sender, rejecting those whose account is
+// suspended or deleted. Suspended users cannot log in, but WebSocket
+// connections and scheduled messages outlive their sessions.
+func (s *MessageService) checkSender(ctx context.Context, senderID string) (*models.User, error) {
+	suspension, err := s.store.GetSuspension(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if suspension != nil {
+		return nil, forbidden("account suspended")
+	}
+
+	sender, err := s.store.GetUserByID(ctx, senderID)
+	if err != nil {
+		return nil, forbidden("account not found")
+	}
+	return sender, nil
+}
+
+// checkBot applies the limits on what bots may send: broadcasts need an
+// admin's permission.
+func checkBot(sender *models.User, msgType models.MessageType) error {
+	if sender.IsBot && msgType == models.MessageTypeBroadcast && !sender.CanBroadcast {
+		return forbidden("bots may not broadcast")
+	}
+	return nil
+}
+
+// prepare validates a request and builds the message it describes.
+func (s *MessageService) prepare(ctx context.Context, senderID, senderName string, req SendRequest) (*models.Message, error) {
+	if !req.Type.IsValid() {
+		return nil, invalidf("invalid message type: %s", req.Type)
+	}
+	if strings.TrimSpace(req.Content) == "" && len(req.Attachments) == 0 {
+		return nil, invalidf("content is required")
+	}
+	if err := validateAttachments(req.Attachments); err != nil {
+		return nil, err
+	}
+	if req.SendAt != nil && !req.SendAt.After(time.Now()) {
+		return nil, invalidf("send_at must be in the future")
+	}
+
+	msg := models.NewMessage(req.Type.String(), req.Content, senderID, senderName)
+	msg.ClientMsgID = req.ClientMsgID
+	msg.Attachments = req.Attachments
+
+	if req.Poll != nil {
+		if err := validatePoll(req.Type, req.Poll); err != nil {
+			return nil, err
+		}
+		msg.Poll = req.Poll
+	}
+	if err := format(msg); err != nil {
+		return nil, err
+	}
+
+	if err := s.setRecipient(ctx, msg, req.ToUserID, req.ToUsername, req.GroupID); err != nil {
+		return nil, err
+	}
+
+	if req.SendAt != nil {
+		msg.Schedule(*req.SendAt)
+	}
+	return msg, nil
+}
+
+// format fills in msg's plain text and entities from its content. A poll's
+// content is its question and isn't formatted.
+func format(msg *models.Message) error {
+	if msg.Poll != nil {
+		msg.Poll.Question = msg.Content
+		msg.PlainText = msg.Content
+		return nil
+	}
+	if err := markup.Format(msg); err != nil {
+		return invalidf("%s", err.Error())
+	}
+	return nil
+}
+
+// setRecipient checks that the sender may post to the requested recipient
+// and addresses msg accordingly.
+func (s *MessageService) setRecipient(ctx context.Context, msg *models.Message, toUserID, toUsername, groupID string) error {
+	switch msg.Type {
+	case models.MessageTypePrivate:
+		var recipient *models.User
+		var err error
+		switch {
+		case toUserID != "":
+			recipient, err = s.store.GetUserByID(ctx, toUserID)
+		case toUsername != "":
+			recipient, err = s.store.GetUserByUsername(ctx, toUsername)
+		default:
+			return invalidf("a recipient is required for private messages")
+		}
+		if err != nil {
+			return notFound("recipient not found")
+		}
+		msg.SetPrivateRecipient(recipient.ID)
+
+	case models.MessageTypeGroup:
+		if groupID == "" {
+			return invalidf("a group is required for group messages")
+		}
+		group, err := s.store.GetGroup(ctx, groupID)
+		if err != nil {
+			if errors.Is(err, store.ErrGroupNotFound) {
+				return notFound("group not found")
+			}
+			return err
+		}
+		if !group.IsMember(msg.FromID) {
+			return forbidden("not a member of this group")
+		}
+		msg.SetGroupRecipient(groupID)
+
+	case models.MessageTypeBroadcast:
+		// No additional validation needed for broadcast
+	}
+
+	return nil
+}
+
+// send runs the middleware chain around persist.
+func (s *MessageService) send(ctx context.Context, msg *models.Message) error {
+	next := s.persist
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		next = s.middleware[i](next)
+	}
+	return next(ctx, msg)
+}
+
+func (s *MessageService) persist(ctx context.Context, msg *models.Message) error {
+	content, plainText := msg.Content, msg.PlainText
+	if err := s.plugins.PreSend(ctx, msg); err != nil {
+		var rejection *plugin.RejectError
+		if errors.As(err, &rejection) {
+			return &Error{Kind: KindRejected, Message: rejection.Reason}
+		}
+		return fmt.Errorf("pre-send hook failed: %w", err)
+	}
+	// The plain text and entities are what search indexes, so they're
+	// derived again if a hook rewrote the content without updating them.
+	if msg.Content != content && msg.PlainText == plainText {
+		if err := format(msg); err != nil {
+			return err
+		}
+	}
+
+	if msg.SendAt != nil && msg.SendAt.After(time.Now()) {
+		if err := s.store.ScheduleMessage(ctx, msg); err != nil {
+			return fmt.Errorf("failed to schedule message: %w", err)
+		}
+		return nil
+	}
+	return s.deliver(ctx, msg)
+}
+
+func (s *MessageService) deliver(ctx context.Context, msg *models.Message) error {
+	if err := s.store.SaveMessage(ctx, msg); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	// Publish errors are logged but not returned: the message has already
+	// been persisted and clients can fetch it from history.
+	if err := s.store.PublishMessage(ctx, msg); err != nil {
+		log.Printf("failed to publish %s message: %v", msg.Type, err)
+	}
+
+	s.plugins.PostSend(ctx, msg)
+	return nil
+}
+
+// finishIdempotentSend records the outcome of a send made under an
+// idempotency key: the message on success, or frees the key on failure so
+// the client can retry. It runs even if the client has gone away.
+func (s *MessageService) finishIdempotentSend(ctx context.Context, senderID, key, token string, msg *models.Message, sendErr error) {
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if sendErr == nil {
+		err = s.store.CompleteIdempotencyKey(ctx, senderID, key, token, msg, IdempotencyWindow)
+	} else {
+		err = s.store.ReleaseIdempotencyKey(ctx, senderID, key, token)
+	}
+	if err != nil {
+		log.Printf("failed to finish idempotent send %s: %v", key, err)
+	}
+}
+
+func validateAttachments(attachments []models.Attachment) error {
+	if len(attachments) > maxAttachments {
+		return invalidf("at most %d attachments are allowed", maxAttachments)
+	}
+	for _, attachment := range attachments {
+		u, err := url.Parse(attachment.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidf("attachment url must be an http or https url")
+		}
+	}
+	return nil
+}
+
+func validatePoll(msgType models.MessageType, poll *models.Poll) error {
+	if msgType != models.MessageTypeGroup {
+		return invalidf("polls can only be sent to groups")
+	}
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return invalidf("polls need between %d and %d options", minPollOptions, maxPollOptions)
+	}
+	for _, option := range poll.Options {
+		if strings.TrimSpace(option) == "" {
+			return invalidf("poll options must not be empty")
+		}
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return invalidf("closes_at must be in the future")
+	}
+	poll.Results = nil
+	return nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	auditLogKey           = "audit_log"
+	userAuditLogKeyPrefix = "audit_log:user:"
+
+	// The audit logs keep only the newest events.
+	maxAuditEvents     = 10000
+	maxUserAuditEvents = 1000
+)
+
+// RecordAuditEvent appends an event to the audit log and, if it concerns a
+// user, to theirs.
+func (s *RedisStore) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.LPush(ctx, auditLogKey, data)
+	pipe.LTrim(ctx, auditLogKey, 0, maxAuditEvents-1)
+	if event.UserID != "" {
+		userKey := fmt.Sprintf("%s%s", userAuditLogKeyPrefix, event.UserID)
+		pipe.LPush(ctx, userKey, data)
+		pipe.LTrim(ctx, userKey, 0, maxUserAuditEvents-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEvents returns audit events newest first, for one user if userID
+// is set.
+func (s *RedisStore) GetAuditEvents(ctx context.Context, userID string, offset, limit int64) ([]*models.AuditEvent, error) {
+	key := auditLogKey
+	if userID != "" {
+		key = fmt.Sprintf("%s%s", userAuditLogKeyPrefix, userID)
+	}
+
+	eventDataList, err := s.client.LRange(ctx, key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+
+	events := make([]*models.AuditEvent, 0, len(eventDataList))
+	for _, eventData := range eventDataList {
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(eventData), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	userBotsKeyPrefix       = "user_bots:"
+	apiKeyKeyPrefix         = "api_key:"
+	botAPIKeysKeyPrefix     = "bot_api_keys:"
+	apiKeyLastUsedKeyPrefix = "api_key_last_used:"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// SaveBot saves a new bot user and adds it to its owner's bots.
+func (s *RedisStore) SaveBot(ctx context.Context, bot *models.User) error {
+	if err := s.SaveUser(ctx, bot); err != nil {
+		return err
+	}
+
+	ownerKey := fmt.Sprintf("%s%s", userBotsKeyPrefix, bot.OwnerID)
+	if err := s.client.SAdd(ctx, ownerKey, bot.ID).Err(); err != nil {
+		return fmt.Errorf("failed to save bot: %w", err)
+	}
+	return nil
+}
+
+// GetUserBots returns the bots a user owns, oldest first.
+func (s *RedisStore) GetUserBots(ctx context.Context, ownerID string) ([]*models.User, error) {
+	ownerKey := fmt.Sprintf("%s%s", userBotsKeyPrefix, ownerID)
+	botIDs, err := s.client.SMembers(ctx, ownerKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bots: %w", err)
+	}
+
+	bots := make([]*models.User, 0, len(botIDs))
+	for _, botID := range botIDs {
+		bot, err := s.GetUserByID(ctx, botID)
+		if err != nil {
+			continue
+		}
+		bots = append(bots, bot)
+	}
+	sort.Slice(bots, func(i, j int) bool {
+		return bots[i].CreatedAt.Before(bots[j].CreatedAt)
+	})
+	return bots, nil
+}
+
+// DeleteBot revokes a bot's API keys and deletes it.
+func (s *RedisStore) DeleteBot(ctx context.Context, bot *models.User) error {
+	keys, err := s.GetAPIKeys(ctx, bot.ID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.DeleteAPIKey(ctx, bot.ID, key.ID); err != nil && !errors.Is(err, ErrAPIKeyNotFound) {
+			return err
+		}
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.SRem(ctx, fmt.Sprintf("%s%s", userBotsKeyPrefix, bot.OwnerID), bot.ID)
+	pipe.Del(ctx, fmt.Sprintf("%s%s", apiKeyLastUsedKeyPrefix, bot.ID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete bot: %w", err)
+	}
+	return s.DeleteUser(ctx, bot)
+}
+
+// SaveAPIKey stores an API key by its hash.
+func (s *RedisStore) SaveAPIKey(ctx context.Context, keyHash string, key *models.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal API key: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%s", apiKeyKeyPrefix, keyHash), data, 0)
+	pipe.HSet(ctx, fmt.Sprintf("%s%s", botAPIKeysKeyPrefix, key.BotID), key.ID, keyHash)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey returns the API key with the given hash.
+func (s *RedisStore) GetAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	data, err := s.client.Get(ctx, fmt.Sprintf("%s%s", apiKeyKeyPrefix, keyHash)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	var key models.APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records when an API key was last used.
+func (s *RedisStore) TouchAPIKey(ctx context.Context, key *models.APIKey, usedAt time.Time) error {
+	lastUsedKey := fmt.Sprintf("%s%s", apiKeyLastUsedKeyPrefix, key.BotID)
+	if err := s.client.HSet(ctx, lastUsedKey, key.ID, usedAt.Unix()).Err(); err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeys returns a bot's API keys, oldest first, with when each was
+// last used.
+func (s *RedisStore) GetAPIKeys(ctx context.Context, botID string) ([]*models.APIKey, error) {
+	hashes, err := s.client.HGetAll(ctx, fmt.Sprintf("%s%s", botAPIKeysKeyPrefix, botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+	lastUsed, err := s.client.HGetAll(ctx, fmt.Sprintf("%s%s", apiKeyLastUsedKeyPrefix, botID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+
+	keys := make([]*models.APIKey, 0, len(hashes))
+	for _, keyHash := range hashes {
+		key, err := s.GetAPIKey(ctx, keyHash)
+		if err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if unix, err := strconv.ParseInt(lastUsed[key.ID], 10, 64); err == nil {
+			usedAt := time.Unix(unix, 0)
+			key.LastUsedAt = &usedAt
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key and closes the WebSockets opened with it.
+func (s *RedisStore) DeleteAPIKey(ctx context.Context, botID, keyID string) error {
+	botKeysKey := fmt.Sprintf("%s%s", botAPIKeysKeyPrefix, botID)
+	keyHash, err := s.client.HGet(ctx, botKeysKey, keyID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrAPIKeyNotFound
+		}
+		return fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("%s%s", apiKeyKeyPrefix, keyHash))
+	pipe.HDel(ctx, botKeysKey, keyID)
+	pipe.HDel(ctx, fmt.Sprintf("%s%s", apiKeyLastUsedKeyPrefix, botID), keyID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	// Connections opened with an API key use its ID as their session ID.
+	return s.publishRevocation(ctx, botID, &TokenRevocation{SessionID: keyID})
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	emailKeyPrefix          = "email:"
+	emailTokenKeyPrefix     = "email_token:"
+	userEmailTokenKeyPrefix = "email_token:user:"
+)
+
+var (
+	ErrEmailTaken           = errors.New("email address is already in use")
+	ErrEmailTokenInvalid    = errors.New("invalid or expired token")
+	errEmailAddressNotFound = errors.New("email address not found")
+)
+
+// releaseEmailScript deletes an email address claim if it is the user's.
+//
+// KEYS: email key
+// ARGV: user ID
+var releaseEmailScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func emailKey(email string) string {
+	return fmt.Sprintf("%s%s", emailKeyPrefix, strings.ToLower(email))
+}
+
+func userEmailTokenKey(purpose models.EmailTokenPurpose, userID string) string {
+	return fmt.Sprintf("%s%s:%s", userEmailTokenKeyPrefix, purpose, userID)
+}
+
+// ClaimEmail reserves a verified email address for a user, so password
+// resets for it reach one account.
+func (s *RedisStore) ClaimEmail(ctx context.Context, userID, email string) error {
+	key := emailKey(email)
+	claimed, err := s.client.SetNX(ctx, key, userID, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to claim email address: %w", err)
+	}
+	if claimed {
+		return nil
+	}
+
+	owner, err := s.client.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to claim email address: %w", err)
+	}
+	if owner != userID {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// ReleaseEmail gives up a user's claim on an email address.
+func (s *RedisStore) ReleaseEmail(ctx context.Context, userID, email string) error {
+	if err := releaseEmailScript.Run(ctx, s.client, []string{emailKey(email)}, userID).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to release email address: %w", err)
+	}
+	return nil
+}
+
+// GetUserByEmail returns the user who verified an email address.
+func (s *RedisStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	userID, err := s.client.Get(ctx, emailKey(email)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, errEmailAddressNotFound
+		}
+		return nil, fmt.Errorf("failed to get user ID: %w", err)
+	}
+
+	return s.GetUserByID(ctx, userID)
+}
+
+// SaveEmailToken stores an emailed token by its hash. Only the newest token
+// of each purpose works for a user.
+func (s *RedisStore) SaveEmailToken(ctx context.Context, tokenHash string, token *models.EmailToken, ttl time.Duration) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal email token: %w", err)
+	}
+
+	if err := s.DeleteEmailToken(ctx, token.Purpose, token.UserID); err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%s", emailTokenKeyPrefix, tokenHash), data, ttl)
+	pipe.Set(ctx, userEmailTokenKey(token.Purpose, token.UserID), tokenHash, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save email token: %w", err)
+	}
+	return nil
+}
+
+// TakeEmailToken returns and deletes the token with the given hash, so each
+// token works once.
+func (s *RedisStore) TakeEmailToken(ctx context.Context, tokenHash string) (*models.EmailToken, error) {
+	data, err := s.client.GetDel(ctx, fmt.Sprintf("%s%s", emailTokenKeyPrefix, tokenHash)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrEmailTokenInvalid
+		}
+		return nil, fmt.Errorf("failed to get email token: %w", err)
+	}
+
+	var token models.EmailToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal email token: %w", err)
+	}
+	return &token, nil
+}
+
+// DeleteEmailToken invalidates the user's outstanding token of a purpose.
+func (s *RedisStore) DeleteEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, userID string) error {
+	userKey := userEmailTokenKey(purpose, userID)
+	tokenHash, err := s.client.GetDel(ctx, userKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return fmt.Errorf("failed to delete email token: %w", err)
+	}
+	if err := s.client.Del(ctx, fmt.Sprintf("%s%s", emailTokenKeyPrefix, tokenHash)).Err(); err != nil {
+		return fmt.Errorf("failed to delete email token: %w", err)
+	}
+	return nil
+}
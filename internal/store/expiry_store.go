@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	conversationTTLKeyPrefix = "conversation_ttl:"
+	expiringQueueKey         = "expiring_messages"
+	expiringDataKey          = "expiring_messages:data"
+)
+
+// SetConversationTTL sets the lifetime of messages sent to a conversation
+// from now on. A zero ttl turns disappearing messages off.
+func (s *RedisStore) SetConversationTTL(ctx context.Context, conversationID string, ttl time.Duration) error {
+	key := fmt.Sprintf("%s%s", conversationTTLKeyPrefix, conversationID)
+
+	var err error
+	if ttl <= 0 {
+		err = s.client.Del(ctx, key).Err()
+	} else {
+		err = s.client.Set(ctx, key, int64(ttl.Seconds()), 0).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set conversation ttl: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) GetConversationTTL(ctx context.Context, conversationID string) (time.Duration, error) {
+	key := fmt.Sprintf("%s%s", conversationTTLKeyPrefix, conversationID)
+	seconds, err := s.client.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get conversation ttl: %w", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// PurgeExpiredMessages claims up to limit messages that expired at or before
+// now, removes them and everything that refers to them, and returns them.
+// Claiming reuses the atomic claim script, so concurrent sweepers never purge
+// the same message; one that fails to purge goes back on the queue.
+func (s *RedisStore) PurgeExpiredMessages(ctx context.Context, now time.Time, limit int64) ([]*models.Message, error) {
+	res, err := claimScript.Run(ctx, s.client, []string{expiringQueueKey, expiringDataKey},
+		now.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expired messages: %w", err)
+	}
+
+	messages := make([]*models.Message, 0, len(res))
+	for _, raw := range res {
+		var msg models.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			log.Printf("dropping malformed expiring message: %v", err)
+			continue
+		}
+
+		if err := s.removeMessage(ctx, &msg); err != nil {
+			log.Printf("failed to purge expired message %s: %v", msg.ID, err)
+			s.requeueExpiring(ctx, &msg, raw, now)
+			continue
+		}
+		messages = append(messages, &msg)
+	}
+
+	return messages, nil
+}
+
+// requeueExpiring puts a claimed message back on the expiry queue so the
+// next sweep retries it.
+func (s *RedisStore) requeueExpiring(ctx context.Context, msg *models.Message, raw string, now time.Time) {
+	expiresAt := now
+	if msg.ExpiresAt != nil {
+		expiresAt = *msg.ExpiresAt
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, expiringDataKey, msg.ID, raw)
+	pipe.ZAdd(ctx, expiringQueueKey, &redis.Z{
+		Score:  float64(expiresAt.UnixMilli()),
+		Member: msg.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("failed to requeue expired message %s: %v", msg.ID, err)
+	}
+}
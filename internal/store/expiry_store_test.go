@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestPurgeExpiredMessages(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	if err := s.SetConversationTTL(ctx, models.PrivateConversationID("alice", "bob"), time.Minute); err != nil {
+		t.Fatalf("SetConversationTTL() error = %v", err)
+	}
+
+	msg := models.NewMessage(string(models.MessageTypePrivate), "hi", "alice", "alice")
+	msg.ToID = "bob"
+	if err := s.SaveMessage(ctx, msg); err != nil {
+		t.Fatalf("SaveMessage() error = %v", err)
+	}
+	if msg.ExpiresAt == nil {
+		t.Fatalf("SaveMessage() didn't set an expiry")
+	}
+
+	purged, err := s.PurgeExpiredMessages(ctx, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("PurgeExpiredMessages() error = %v", err)
+	}
+	if len(purged) != 0 {
+		t.Fatalf("purged %d messages before they expired", len(purged))
+	}
+
+	purged, err = s.PurgeExpiredMessages(ctx, msg.ExpiresAt.Add(time.Second), 10)
+	if err != nil {
+		t.Fatalf("PurgeExpiredMessages() error = %v", err)
+	}
+	if len(purged) != 1 || purged[0].ID != msg.ID {
+		t.Fatalf("PurgeExpiredMessages() = %+v, want only %s", purged, msg.ID)
+	}
+
+	if _, err := s.GetMessage(ctx, msg.ID); err != ErrMessageNotFound {
+		t.Errorf("GetMessage() error = %v, want %v", err, ErrMessageNotFound)
+	}
+	history, err := s.GetPrivateMessages(ctx, "alice", "bob", 10)
+	if err != nil {
+		t.Fatalf("GetPrivateMessages() error = %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("history has %d messages, want 0", len(history))
+	}
+}
+
+// saveExpiringMessage saves a private message from alice to bob in a
+// conversation whose messages last a minute.
+func saveExpiringMessage(t *testing.T, s *RedisStore) *models.Message {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := s.SetConversationTTL(ctx, models.PrivateConversationID("alice", "bob"), time.Minute); err != nil {
+		t.Fatalf("SetConversationTTL() error = %v", err)
+	}
+	msg := models.NewMessage(string(models.MessageTypePrivate), "hi", "alice", "alice")
+	msg.ToID = "bob"
+	if err := s.SaveMessage(ctx, msg); err != nil {
+		t.Fatalf("SaveMessage() error = %v", err)
+	}
+	return msg
+}
+
+func TestPurgeExpiredMessagesRemovesPinsAndStars(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	msg := saveExpiringMessage(t, s)
+	if err := s.PinMessage(ctx, msg.ConversationID(), models.NewPin(msg.ID, "alice"), models.MaxPinsPerConversation); err != nil {
+		t.Fatalf("PinMessage() error = %v", err)
+	}
+	if err := s.StarMessage(ctx, "bob", models.NewStar(msg)); err != nil {
+		t.Fatalf("StarMessage() error = %v", err)
+	}
+
+	purged, err := s.PurgeExpiredMessages(ctx, msg.ExpiresAt.Add(time.Second), 10)
+	if err != nil || len(purged) != 1 {
+		t.Fatalf("PurgeExpiredMessages() = %d messages, %v; want 1", len(purged), err)
+	}
+
+	pins, err := s.GetPins(ctx, msg.ConversationID())
+	if err != nil {
+		t.Fatalf("GetPins() error = %v", err)
+	}
+	if len(pins) != 0 {
+		t.Errorf("GetPins() = %d pins, want 0", len(pins))
+	}
+	stars, err := s.GetStars(ctx, "bob", "", 0, 10)
+	if err != nil {
+		t.Fatalf("GetStars() error = %v", err)
+	}
+	if len(stars) != 0 {
+		t.Errorf("GetStars() = %d stars, want 0", len(stars))
+	}
+}
+
+func TestPurgeExpiredMessagesRequeuesFailures(t *testing.T) {
+	s, mr := newTestStore(t)
+	ctx := context.Background()
+
+	msg := saveExpiringMessage(t, s)
+
+	// A history list of the wrong type makes removal fail.
+	historyKey := messageListKeys(msg)[0]
+	mr.Del(historyKey)
+	if err := mr.Set(historyKey, "corrupt"); err != nil {
+		t.Fatal(err)
+	}
+
+	sweepAt := msg.ExpiresAt.Add(time.Second)
+	purged, err := s.PurgeExpiredMessages(ctx, sweepAt, 10)
+	if err != nil {
+		t.Fatalf("PurgeExpiredMessages() error = %v", err)
+	}
+	if len(purged) != 0 {
+		t.Fatalf("PurgeExpiredMessages() = %d messages, want 0", len(purged))
+	}
+
+	mr.Del(historyKey)
+	purged, err = s.PurgeExpiredMessages(ctx, sweepAt, 10)
+	if err != nil {
+		t.Fatalf("PurgeExpiredMessages() error = %v", err)
+	}
+	if len(purged) != 1 || purged[0].ID != msg.ID {
+		t.Fatalf("retried PurgeExpiredMessages() = %+v, want only %s", purged, msg.ID)
+	}
+}
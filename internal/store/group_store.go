@@ -3,11 +3,17 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+
+	"github.com/go-redis/redis/v8"
+
 	"github.com/bm-197/go-chat/internal/models"
 )
 
+var ErrGroupNotFound = errors.New("group not found")
+
 const (
 	groupKeyPrefix      = "group:"
 	groupListKey        = "groups"
@@ -42,6 +48,9 @@ func (s *RedisStore) GetGroup(ctx context.Context, id string) (*models.Group, er
 	key := fmt.Sprintf("%s%s", groupKeyPrefix, id)
 	groupData, err := s.client.Get(ctx, key).Bytes()
 	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrGroupNotFound
+		}
 		return nil, fmt.Errorf("failed to get group: %w", err)
 	}
 
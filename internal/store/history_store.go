@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+// MessageAnchor selects the message a history window is centered on: the
+// message with MessageID, or else the first message sent at or after At.
+type MessageAnchor struct {
+	MessageID string
+	At        time.Time
+}
+
+// MessageWindow is a slice of history around an anchor message.
+type MessageWindow struct {
+	Messages  []*models.Message `json:"messages"`
+	AnchorID  string            `json:"anchor_id"`
+	HasBefore bool              `json:"has_before"`
+	HasAfter  bool              `json:"has_after"`
+}
+
+func (s *RedisStore) GetPrivateMessagesAround(ctx context.Context, user1, user2 string, anchor MessageAnchor, before, after int64) (*MessageWindow, error) {
+	key := fmt.Sprintf("%s%s:%s", privateMessageKeyPrefix, user1, user2)
+	return s.getMessagesAround(ctx, key, anchor, before, after)
+}
+
+func (s *RedisStore) GetGroupMessagesAround(ctx context.Context, groupID string, anchor MessageAnchor, before, after int64) (*MessageWindow, error) {
+	key := fmt.Sprintf("%s%s", groupMessageKeyPrefix, groupID)
+	return s.getMessagesAround(ctx, key, anchor, before, after)
+}
+
+func (s *RedisStore) GetBroadcastMessagesAround(ctx context.Context, anchor MessageAnchor, before, after int64) (*MessageWindow, error) {
+	return s.getMessagesAround(ctx, broadcastKeyPrefix, anchor, before, after)
+}
+
+func (s *RedisStore) getMessagesAround(ctx context.Context, key string, anchor MessageAnchor, before, after int64) (*MessageWindow, error) {
+	var index int64
+	var err error
+	if anchor.MessageID != "" {
+		index, err = s.messageIndex(ctx, key, anchor.MessageID)
+	} else {
+		index, err = s.firstIndexAtOrAfter(ctx, key, anchor.At)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	start := max(index-before, 0)
+	pipe := s.client.Pipeline()
+	rangeCmd := pipe.LRange(ctx, key, start, index+after)
+	lenCmd := pipe.LLen(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	window := &MessageWindow{
+		Messages:  make([]*models.Message, 0, len(rangeCmd.Val())),
+		HasBefore: start > 0,
+		HasAfter:  index+after < lenCmd.Val()-1,
+	}
+
+	now := time.Now()
+	for i, msgData := range rangeCmd.Val() {
+		var msg models.Message
+		if err := json.Unmarshal([]byte(msgData), &msg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		if start+int64(i) == index {
+			window.AnchorID = msg.ID
+		}
+		if msg.IsExpired(now) {
+			continue
+		}
+		window.Messages = append(window.Messages, &msg)
+	}
+
+	return window, nil
+}
+
+// messageIndex finds a message in a history list by its ID.
+func (s *RedisStore) messageIndex(ctx context.Context, key, messageID string) (int64, error) {
+	keys := []string{fmt.Sprintf("%s%s", messageKeyPrefix, messageID), key}
+	index, err := messageIndexScript.Run(ctx, s.client, keys).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, ErrMessageNotFound
+		}
+		return 0, fmt.Errorf("failed to locate message: %w", err)
+	}
+	return index, nil
+}
+
+// firstIndexAtOrAfter binary searches a history list, which is in send order,
+// for the first message with a timestamp at or after at.
+func (s *RedisStore) firstIndexAtOrAfter(ctx context.Context, key string, at time.Time) (int64, error) {
+	length, err := s.client.LLen(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get history length: %w", err)
+	}
+
+	lo, hi := int64(0), length
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		msgData, err := s.client.LIndex(ctx, key, mid).Bytes()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get message: %w", err)
+		}
+
+		var msg models.Message
+		if err := json.Unmarshal(msgData, &msg); err != nil {
+			return 0, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+
+		if msg.Timestamp.Before(at) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	if lo == length {
+		return 0, ErrMessageNotFound
+	}
+	return lo, nil
+}
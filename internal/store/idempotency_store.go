@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var ErrSendInProgress = errors.New("a send with this idempotency key is in progress")
+
+const (
+	idempotencyKeyPrefix = "idempotency:"
+
+	// A reserved key holds this prefix and the reservation's token until
+	// the send completes.
+	idempotencyPendingPrefix = "pending:"
+
+	// idempotencyPendingTTL bounds how long a send that never completes or
+	// releases its key, e.g. because the server crashed, blocks retries.
+	idempotencyPendingTTL = 30 * time.Second
+)
+
+// completeIdempotencyScript stores a send's message under its key, unless
+// the reservation lapsed and another send reserved the key since.
+//
+// KEYS: idempotency key
+// ARGV: pending value, message JSON, window in milliseconds
+// Returns: 1 if stored, else 0
+var completeIdempotencyScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value and value ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// releaseIdempotencyScript deletes a key only while it still holds the
+// caller's reservation.
+//
+// KEYS: idempotency key
+// ARGV: pending value
+// Returns: 1 if released, else 0
+var releaseIdempotencyScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func idempotencyKey(userID, key string) string {
+	return fmt.Sprintf("%s%s:%s", idempotencyKeyPrefix, userID, key)
+}
+
+// ReserveIdempotencyKey claims key for a new send by userID. It returns the
+// stored message when an earlier send with the same key already completed
+// within its window, and ErrSendInProgress while that send is still running.
+// A nil message and nil error mean the caller owns the key and must either
+// complete or release it with the returned token; a reservation that is
+// neither lapses after idempotencyPendingTTL.
+func (s *RedisStore) ReserveIdempotencyKey(ctx context.Context, userID, key string) (*models.Message, string, error) {
+	redisKey := idempotencyKey(userID, key)
+	token := uuid.New().String()
+
+	reserved, err := s.client.SetNX(ctx, redisKey, idempotencyPendingPrefix+token, idempotencyPendingTTL).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if reserved {
+		return nil, token, nil
+	}
+
+	value, err := s.client.Get(ctx, redisKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			// Expired between the two calls; treat it as a fresh send.
+			return s.ReserveIdempotencyKey(ctx, userID, key)
+		}
+		return nil, "", fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if strings.HasPrefix(value, idempotencyPendingPrefix) {
+		return nil, "", ErrSendInProgress
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal([]byte(value), &msg); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return &msg, "", nil
+}
+
+// CompleteIdempotencyKey records the message a reserved key produced so
+// retries within window get it back.
+func (s *RedisStore) CompleteIdempotencyKey(ctx context.Context, userID, key, token string, msg *models.Message, window time.Duration) error {
+	msgData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	keys := []string{idempotencyKey(userID, key)}
+	if err := completeIdempotencyScript.Run(ctx, s.client, keys, idempotencyPendingPrefix+token, msgData, window.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a reserved key after a failed send so the
+// client can retry. A reservation that already lapsed is left alone, since
+// the key may now belong to another send.
+func (s *RedisStore) ReleaseIdempotencyKey(ctx context.Context, userID, key, token string) error {
+	keys := []string{idempotencyKey(userID, key)}
+	if err := releaseIdempotencyScript.Run(ctx, s.client, keys, idempotencyPendingPrefix+token).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	existing, token, err := s.ReserveIdempotencyKey(ctx, "alice", "k1")
+	if err != nil || existing != nil || token == "" {
+		t.Fatalf("ReserveIdempotencyKey() = %v, %q, %v; want a reservation", existing, token, err)
+	}
+
+	if _, _, err := s.ReserveIdempotencyKey(ctx, "alice", "k1"); err != ErrSendInProgress {
+		t.Errorf("reserving a pending key error = %v, want %v", err, ErrSendInProgress)
+	}
+	if _, other, err := s.ReserveIdempotencyKey(ctx, "bob", "k1"); err != nil || other == "" {
+		t.Errorf("another user's key = %q, %v; want a reservation", other, err)
+	}
+
+	msg := models.NewMessage(string(models.MessageTypeBroadcast), "hi", "alice", "alice")
+	if err := s.CompleteIdempotencyKey(ctx, "alice", "k1", token, msg, time.Hour); err != nil {
+		t.Fatalf("CompleteIdempotencyKey() error = %v", err)
+	}
+
+	existing, _, err = s.ReserveIdempotencyKey(ctx, "alice", "k1")
+	if err != nil || existing == nil || existing.ID != msg.ID {
+		t.Fatalf("ReserveIdempotencyKey() after completion = %v, %v; want %s", existing, err, msg.ID)
+	}
+}
+
+func TestReleaseIdempotencyKeyKeepsOtherReservations(t *testing.T) {
+	s, mr := newTestStore(t)
+	ctx := context.Background()
+
+	_, stale, err := s.ReserveIdempotencyKey(ctx, "alice", "k1")
+	if err != nil {
+		t.Fatalf("ReserveIdempotencyKey() error = %v", err)
+	}
+
+	// The first reservation lapses and a retry takes the key over.
+	mr.FastForward(idempotencyPendingTTL + time.Second)
+	_, current, err := s.ReserveIdempotencyKey(ctx, "alice", "k1")
+	if err != nil || current == "" {
+		t.Fatalf("ReserveIdempotencyKey() = %q, %v; want a reservation", current, err)
+	}
+
+	if err := s.ReleaseIdempotencyKey(ctx, "alice", "k1", stale); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey() error = %v", err)
+	}
+	msg := models.NewMessage(string(models.MessageTypeBroadcast), "hi", "alice", "alice")
+	if err := s.CompleteIdempotencyKey(ctx, "alice", "k1", stale, msg, time.Hour); err != nil {
+		t.Fatalf("CompleteIdempotencyKey() error = %v", err)
+	}
+	if _, _, err := s.ReserveIdempotencyKey(ctx, "alice", "k1"); err != ErrSendInProgress {
+		t.Errorf("stale release or completion freed the key: error = %v, want %v", err, ErrSendInProgress)
+	}
+
+	if err := s.ReleaseIdempotencyKey(ctx, "alice", "k1", current); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey() error = %v", err)
+	}
+	if existing, token, err := s.ReserveIdempotencyKey(ctx, "alice", "k1"); err != nil || existing != nil || token == "" {
+		t.Errorf("ReserveIdempotencyKey() after release = %v, %q, %v; want a reservation", existing, token, err)
+	}
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	oidcLoginKeyPrefix      = "oidc_login:"
+	identityKeyPrefix       = "identity:"
+	userIdentitiesKeyPrefix = "user_identities:"
+)
+
+var (
+	ErrOIDCLoginNotFound = errors.New("sign-in expired or unknown")
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrIdentityLinked    = errors.New("identity is linked to another user")
+)
+
+func identityKey(provider, subject string) string {
+	return fmt.Sprintf("%s%s:%s", identityKeyPrefix, provider, subject)
+}
+
+// SaveOIDCLogin keeps a sign-in in progress under its state parameter.
+func (s *RedisStore) SaveOIDCLogin(ctx context.Context, state string, login *models.OIDCLogin, ttl time.Duration) error {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sign-in: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%s", oidcLoginKeyPrefix, state)
+	if err := s.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save sign-in: %w", err)
+	}
+	return nil
+}
+
+// TakeOIDCLogin returns and deletes the sign-in for state, so each state
+// can complete one sign-in.
+func (s *RedisStore) TakeOIDCLogin(ctx context.Context, state string) (*models.OIDCLogin, error) {
+	key := fmt.Sprintf("%s%s", oidcLoginKeyPrefix, state)
+	data, err := s.client.GetDel(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrOIDCLoginNotFound
+		}
+		return nil, fmt.Errorf("failed to get sign-in: %w", err)
+	}
+
+	var login models.OIDCLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sign-in: %w", err)
+	}
+	return &login, nil
+}
+
+// GetIdentity returns the link for a provider account.
+func (s *RedisStore) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	data, err := s.client.Get(ctx, identityKey(provider, subject)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	var identity models.Identity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// LinkIdentity links a provider account to a user. A provider account links
+// to one user at a time; linking it again to the same user is a no-op.
+func (s *RedisStore) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity: %w", err)
+	}
+
+	key := identityKey(identity.Provider, identity.Subject)
+	linked, err := s.client.SetNX(ctx, key, data, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	if !linked {
+		existing, err := s.GetIdentity(ctx, identity.Provider, identity.Subject)
+		if err != nil {
+			return err
+		}
+		if existing.UserID != identity.UserID {
+			return ErrIdentityLinked
+		}
+		return nil
+	}
+
+	userKey := fmt.Sprintf("%s%s", userIdentitiesKeyPrefix, identity.UserID)
+	if err := s.client.HSet(ctx, userKey, identity.Provider, identity.Subject).Err(); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// GetUserIdentities returns the provider accounts linked to a user.
+func (s *RedisStore) GetUserIdentities(ctx context.Context, userID string) ([]*models.Identity, error) {
+	userKey := fmt.Sprintf("%s%s", userIdentitiesKeyPrefix, userID)
+	subjects, err := s.client.HGetAll(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	identities := make([]*models.Identity, 0, len(subjects))
+	for provider, subject := range subjects {
+		identity, err := s.GetIdentity(ctx, provider, subject)
+		if err != nil {
+			if errors.Is(err, ErrIdentityNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes the user's link to a provider.
+func (s *RedisStore) UnlinkIdentity(ctx context.Context, userID, provider string) error {
+	userKey := fmt.Sprintf("%s%s", userIdentitiesKeyPrefix, userID)
+	subject, err := s.client.HGet(ctx, userKey, provider).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrIdentityNotFound
+		}
+		return fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, identityKey(provider, subject))
+	pipe.HDel(ctx, userKey, provider)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	return nil
+}
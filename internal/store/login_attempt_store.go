@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	loginFailuresKeyPrefix = "login_failures:"
+	loginLockKeyPrefix     = "login_lock:"
+)
+
+// recordLoginFailureScript counts a failed login and, past the free
+// attempts, locks the subject out for a delay that doubles with every
+// further failure.
+//
+// KEYS: failure counter, lock
+// ARGV: counter TTL ms, free attempts, base delay ms, max delay ms
+// Returns: {failures, lockout ms}
+var recordLoginFailureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+
+local free = tonumber(ARGV[2])
+if failures <= free then
+	return {failures, 0}
+end
+local delay = math.min(tonumber(ARGV[3]) * 2 ^ (failures - free - 1), tonumber(ARGV[4]))
+delay = math.floor(delay)
+redis.call('SET', KEYS[2], failures, 'PX', delay)
+return {failures, delay}
+`)
+
+// LoginLockoutPolicy is how many failed logins a subject gets before it is
+// locked out, and for how long.
+type LoginLockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration // Lockout after the first failure past the free ones
+	MaxDelay     time.Duration
+	Window       time.Duration // Failures are forgotten after this long without one
+}
+
+// RecordLoginFailure counts a failed login for subject and returns the
+// failures so far and how long the subject is now locked out.
+func (s *RedisStore) RecordLoginFailure(ctx context.Context, subject string, policy LoginLockoutPolicy) (int64, time.Duration, error) {
+	failuresKey := fmt.Sprintf("%s%s", loginFailuresKeyPrefix, subject)
+	lockKey := fmt.Sprintf("%s%s", loginLockKeyPrefix, subject)
+
+	res, err := recordLoginFailureScript.Run(ctx, s.client, []string{failuresKey, lockKey},
+		policy.Window.Milliseconds(), policy.FreeAttempts, policy.BaseDelay.Milliseconds(), policy.MaxDelay.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// GetLoginLockout returns how long the longest lockout among subjects has
+// left, or 0 if none is locked out.
+func (s *RedisStore) GetLoginLockout(ctx context.Context, subjects ...string) (time.Duration, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	for i, subject := range subjects {
+		cmds[i] = pipe.PTTL(ctx, fmt.Sprintf("%s%s", loginLockKeyPrefix, subject))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to get login lockout: %w", err)
+	}
+
+	var lockout time.Duration
+	for _, cmd := range cmds {
+		// Missing keys report a negative TTL.
+		if ttl := cmd.Val(); ttl > lockout {
+			lockout = ttl
+		}
+	}
+	return lockout, nil
+}
+
+// ClearLoginFailures forgets the failed logins of subject.
+func (s *RedisStore) ClearLoginFailures(ctx context.Context, subject string) error {
+	err := s.client.Del(ctx,
+		fmt.Sprintf("%s%s", loginFailuresKeyPrefix, subject),
+		fmt.Sprintf("%s%s", loginLockKeyPrefix, subject),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
@@ -3,51 +3,275 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
 
 	"github.com/bm-197/go-chat/internal/models"
 )
 
+var ErrMessageNotFound = errors.New("message not found")
+
 const (
+	messageKeyPrefix        = "msg:"
 	privateMessageKeyPrefix = "private_msg:"
 	groupMessageKeyPrefix   = "group_msg:"
 	broadcastKeyPrefix      = "broadcast"
 )
 
+// saveMessageScript stores a message and appends it to its history lists,
+// unless the conversation's message TTL differs from the one the message's
+// expiry was computed with. A message whose ID is already stored isn't
+// appended again, so retried deliveries don't duplicate history.
+//
+// KEYS: conversation TTL key, message key, history lists...
+// ARGV: expected TTL seconds, message JSON
+// Returns: -1 if saved, the stored message JSON if it already was, else the
+// conversation's TTL seconds
+var saveMessageScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[2])
+if stored then
+	return stored
+end
+local ttl = tonumber(redis.call('GET', KEYS[1]) or '0')
+if ttl ~= tonumber(ARGV[1]) then
+	return ttl
+end
+redis.call('SET', KEYS[2], ARGV[2])
+for i = 3, #KEYS do
+	redis.call('RPUSH', KEYS[i], ARGV[2])
+end
+return -1
+`)
+
+// History lists hold the same bytes as the message's own key, which serves as
+// the index from message ID to list entry: scripts look an entry up by
+// reading the message key and let Redis match it natively, rather than
+// decoding the list in Lua.
+
+// removeMessageScript removes a message from history lists.
+//
+// KEYS: message key, history lists...
+// Returns: 1 if the message was found, else 0
+var removeMessageScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+	return 0
+end
+for i = 2, #KEYS do
+	redis.call('LREM', KEYS[i], 1, raw)
+end
+return 1
+`)
+
+// messageIndexScript finds a message in a history list.
+//
+// KEYS: message key, history list
+// Returns: the message's index, or nil if it isn't in the list
+var messageIndexScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+	return nil
+end
+return redis.call('LPOS', KEYS[2], raw)
+`)
+
+// SaveMessage stores a message and sets its expiry from the conversation's
+// message TTL. The TTL is checked by the save script, so only conversations
+// with disappearing messages need a second round trip.
 func (s *RedisStore) SaveMessage(ctx context.Context, msg *models.Message) error {
-	msgData, err := json.Marshal(msg)
+	if !msg.Type.IsValid() {
+		return fmt.Errorf("invalid message type: %s", msg.Type)
+	}
+
+	keys := append([]string{
+		fmt.Sprintf("%s%s", conversationTTLKeyPrefix, msg.ConversationID()),
+		fmt.Sprintf("%s%s", messageKeyPrefix, msg.ID),
+	}, messageListKeys(msg)...)
+
+	var ttl int64
+	var msgData []byte
+	for {
+		msg.ExpiresAt = nil
+		if ttl > 0 {
+			expiresAt := msg.Timestamp.Add(time.Duration(ttl) * time.Second)
+			msg.ExpiresAt = &expiresAt
+		}
+
+		var err error
+		msgData, err = json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+
+		res, err := saveMessageScript.Run(ctx, s.client, keys, ttl, msgData).Result()
+		if err != nil {
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+		if stored, ok := res.(string); ok {
+			// Finish indexing the earlier save, which may have failed
+			// after storing the message.
+			msgData = []byte(stored)
+			if err := json.Unmarshal(msgData, msg); err != nil {
+				return fmt.Errorf("failed to unmarshal message: %w", err)
+			}
+			break
+		}
+		current, _ := res.(int64)
+		if current < 0 {
+			break
+		}
+		ttl = current
+	}
+
+	pipe := s.client.Pipeline()
+	indexMessage(ctx, pipe, msg)
+	if msg.ExpiresAt != nil {
+		pipe.HSet(ctx, expiringDataKey, msg.ID, msgData)
+		pipe.ZAdd(ctx, expiringQueueKey, &redis.Z{
+			Score:  float64(msg.ExpiresAt.UnixMilli()),
+			Member: msg.ID,
+		})
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteMessage removes a message from history, search, pins, stars and the
+// expiry queue and returns it.
+func (s *RedisStore) DeleteMessage(ctx context.Context, id string) (*models.Message, error) {
+	msgData, err := s.client.Get(ctx, fmt.Sprintf("%s%s", messageKeyPrefix, id)).Result()
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		if err == redis.Nil {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
 
-	var key string
+	var msg models.Message
+	if err := json.Unmarshal([]byte(msgData), &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	if err := s.removeMessage(ctx, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// removeMessage removes a message and everything that refers to it. It can
+// be retried after a failure: the history entries are found through the
+// message key, which goes last.
+func (s *RedisStore) removeMessage(ctx context.Context, msg *models.Message) error {
+	key := fmt.Sprintf("%s%s", messageKeyPrefix, msg.ID)
+	if err := removeMessageScript.Run(ctx, s.client, append([]string{key}, messageListKeys(msg)...)).Err(); err != nil {
+		return fmt.Errorf("failed to remove message from history: %w", err)
+	}
+
+	starsKey := fmt.Sprintf("%s%s", messageStarsKeyPrefix, msg.ID)
+	starredBy, err := s.client.SMembers(ctx, starsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get stars: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZRem(ctx, expiringQueueKey, msg.ID)
+	pipe.HDel(ctx, expiringDataKey, msg.ID)
+	pinOrderKey, pinDataKey := pinKeys(msg.ConversationID())
+	pipe.ZRem(ctx, pinOrderKey, msg.ID)
+	pipe.HDel(ctx, pinDataKey, msg.ID)
+	for _, userID := range starredBy {
+		orderKey, dataKey := starKeys(userID)
+		pipe.HDel(ctx, dataKey, msg.ID)
+		pipe.ZRem(ctx, orderKey, msg.ID)
+		pipe.ZRem(ctx, conversationStarsKey(userID, msg.ConversationID()), msg.ID)
+	}
+	pipe.Del(ctx, starsKey)
+	unindexMessage(ctx, pipe, msg)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// messageListKeys returns the history lists a message is appended to.
+func messageListKeys(msg *models.Message) []string {
 	switch msg.Type {
 	case models.MessageTypePrivate:
-		key1 := fmt.Sprintf("%s%s:%s", privateMessageKeyPrefix, msg.FromID, msg.ToID)
-		key2 := fmt.Sprintf("%s%s:%s", privateMessageKeyPrefix, msg.ToID, msg.FromID)
+		return []string{
+			fmt.Sprintf("%s%s:%s", privateMessageKeyPrefix, msg.FromID, msg.ToID),
+			fmt.Sprintf("%s%s:%s", privateMessageKeyPrefix, msg.ToID, msg.FromID),
+		}
+	case models.MessageTypeGroup:
+		return []string{fmt.Sprintf("%s%s", groupMessageKeyPrefix, msg.GroupID)}
+	default:
+		return []string{broadcastKeyPrefix}
+	}
+}
 
-		pipe := s.client.Pipeline()
-		pipe.RPush(ctx, key1, msgData)
-		pipe.RPush(ctx, key2, msgData)
-		_, err = pipe.Exec(ctx)
+func (s *RedisStore) GetMessage(ctx context.Context, id string) (*models.Message, error) {
+	msgData, err := s.client.Get(ctx, fmt.Sprintf("%s%s", messageKeyPrefix, id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
 
-	case models.MessageTypeGroup:
-		key = fmt.Sprintf("%s%s", groupMessageKeyPrefix, msg.GroupID)
-		err = s.client.RPush(ctx, key, msgData).Err()
+	var msg models.Message
+	if err := json.Unmarshal(msgData, &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	if msg.IsExpired(time.Now()) {
+		return nil, ErrMessageNotFound
+	}
 
-	case models.MessageTypeBroadcast:
-		key = broadcastKeyPrefix
-		err = s.client.RPush(ctx, key, msgData).Err()
+	return &msg, nil
+}
 
-	default:
-		return fmt.Errorf("invalid message type: %s", msg.Type)
+// GetMessagesByID loads messages by ID, preserving order and skipping ones
+// that no longer exist or have expired.
+func (s *RedisStore) GetMessagesByID(ctx context.Context, ids []string) ([]*models.Message, error) {
+	if len(ids) == 0 {
+		return []*models.Message{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("%s%s", messageKeyPrefix, id)
 	}
 
+	msgDataList, err := s.client.MGet(ctx, keys...).Result()
 	if err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
-	return nil
+	now := time.Now()
+	messages := make([]*models.Message, 0, len(ids))
+	for _, msgData := range msgDataList {
+		raw, ok := msgData.(string)
+		if !ok {
+			continue
+		}
+
+		var msg models.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		if msg.IsExpired(now) {
+			continue
+		}
+		messages = append(messages, &msg)
+	}
+
+	return messages, nil
 }
 
 func (s *RedisStore) GetPrivateMessages(ctx context.Context, user1, user2 string, limit int64) ([]*models.Message, error) {
@@ -70,12 +294,17 @@ func (s *RedisStore) getMessages(ctx context.Context, key string, limit int64) (
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
+	now := time.Now()
 	messages := make([]*models.Message, 0, len(msgDataList))
 	for _, msgData := range msgDataList {
 		var msg models.Message
 		if err := json.Unmarshal([]byte(msgData), &msg); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
 		}
+		// Expired messages linger until the sweeper purges them.
+		if msg.IsExpired(now) {
+			continue
+		}
 		messages = append(messages, &msg)
 	}
 
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestSaveMessageIsIdempotent(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	msg := models.NewMessage(string(models.MessageTypePrivate), "hi", "alice", "alice")
+	msg.ToID = "bob"
+	if err := s.SaveMessage(ctx, msg); err != nil {
+		t.Fatalf("SaveMessage() error = %v", err)
+	}
+
+	retry := *msg
+	retry.Timestamp = msg.Timestamp.Add(time.Minute)
+	if err := s.SaveMessage(ctx, &retry); err != nil {
+		t.Fatalf("second SaveMessage() error = %v", err)
+	}
+	if !retry.Timestamp.Equal(msg.Timestamp) {
+		t.Errorf("retried message timestamp = %v, want the stored %v", retry.Timestamp, msg.Timestamp)
+	}
+
+	history, err := s.GetPrivateMessages(ctx, "alice", "bob", 10)
+	if err != nil {
+		t.Fatalf("GetPrivateMessages() error = %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("history has %d messages, want 1", len(history))
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	var messages []*models.Message
+	for i := 0; i < 3; i++ {
+		msg := models.NewMessage(string(models.MessageTypeGroup), "hi", "alice", "alice")
+		msg.GroupID = "g1"
+		if err := s.SaveMessage(ctx, msg); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	window, err := s.GetGroupMessagesAround(ctx, "g1", MessageAnchor{MessageID: messages[1].ID}, 1, 1)
+	if err != nil {
+		t.Fatalf("GetGroupMessagesAround() error = %v", err)
+	}
+	if window.AnchorID != messages[1].ID || len(window.Messages) != 3 {
+		t.Fatalf("window = anchor %s with %d messages, want %s with 3", window.AnchorID, len(window.Messages), messages[1].ID)
+	}
+
+	if _, err := s.DeleteMessage(ctx, messages[1].ID); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if _, err := s.DeleteMessage(ctx, messages[1].ID); err != ErrMessageNotFound {
+		t.Errorf("second DeleteMessage() error = %v, want %v", err, ErrMessageNotFound)
+	}
+
+	history, err := s.GetGroupMessages(ctx, "g1", 10)
+	if err != nil {
+		t.Fatalf("GetGroupMessages() error = %v", err)
+	}
+	if len(history) != 2 || history[0].ID != messages[0].ID || history[1].ID != messages[2].ID {
+		t.Errorf("history = %+v, want the first and last messages", history)
+	}
+
+	_, err = s.GetGroupMessagesAround(ctx, "g1", MessageAnchor{MessageID: messages[1].ID}, 1, 1)
+	if err != ErrMessageNotFound {
+		t.Errorf("GetGroupMessagesAround(deleted) error = %v, want %v", err, ErrMessageNotFound)
+	}
+}
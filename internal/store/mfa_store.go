@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	totpKeyPrefix          = "totp:"
+	totpUsedKeyPrefix      = "totp_used:"
+	recoveryCodesKeyPrefix = "recovery_codes:"
+	mfaChallengeKeyPrefix  = "mfa_challenge:"
+)
+
+var ErrMFAChallengeInvalid = errors.New("invalid or expired challenge")
+
+// attemptMFAChallengeScript counts an attempt at answering a login
+// challenge.
+//
+// KEYS: challenge key
+// Returns: {user ID, attempts}, or nil if the challenge doesn't exist
+var attemptMFAChallengeScript = redis.NewScript(`
+local userID = redis.call('HGET', KEYS[1], 'user_id')
+if not userID then
+	return nil
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+return {userID, attempts}
+`)
+
+// GetTOTP returns the user's TOTP enrollment, or nil if there is none.
+func (s *RedisStore) GetTOTP(ctx context.Context, userID string) (*models.TOTPConfig, error) {
+	key := fmt.Sprintf("%s%s", totpKeyPrefix, userID)
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP config: %w", err)
+	}
+
+	var config models.TOTPConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TOTP config: %w", err)
+	}
+	return &config, nil
+}
+
+// SaveTOTP saves the user's TOTP enrollment. Enabling it replaces the
+// recovery codes with recoveryCodeHashes.
+func (s *RedisStore) SaveTOTP(ctx context.Context, userID string, config *models.TOTPConfig, recoveryCodeHashes []string) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP config: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%s", totpKeyPrefix, userID), data, 0)
+	if config.Enabled {
+		replaceRecoveryCodes(ctx, pipe, userID, recoveryCodeHashes)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save TOTP config: %w", err)
+	}
+	return nil
+}
+
+// DeleteTOTP turns two-factor authentication off for the user.
+func (s *RedisStore) DeleteTOTP(ctx context.Context, userID string) error {
+	err := s.client.Del(ctx,
+		fmt.Sprintf("%s%s", totpKeyPrefix, userID),
+		fmt.Sprintf("%s%s", recoveryCodesKeyPrefix, userID),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete TOTP config: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a code for a time step was used, so it can't be
+// replayed. It reports false if the step was already used.
+func (s *RedisStore) UseTOTPStep(ctx context.Context, userID string, step int64, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("%s%s:%d", totpUsedKeyPrefix, userID, step)
+	fresh, err := s.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP code use: %w", err)
+	}
+	return fresh, nil
+}
+
+func (s *RedisStore) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	pipe := s.client.TxPipeline()
+	replaceRecoveryCodes(ctx, pipe, userID, hashes)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, pipe redis.Pipeliner, userID string, hashes []string) {
+	key := fmt.Sprintf("%s%s", recoveryCodesKeyPrefix, userID)
+	pipe.Del(ctx, key)
+	if len(hashes) > 0 {
+		members := make([]interface{}, len(hashes))
+		for i, hash := range hashes {
+			members[i] = hash
+		}
+		pipe.SAdd(ctx, key, members...)
+	}
+}
+
+// UseRecoveryCode removes a recovery code and reports whether it was
+// valid. Each code works once.
+func (s *RedisStore) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	key := fmt.Sprintf("%s%s", recoveryCodesKeyPrefix, userID)
+	removed, err := s.client.SRem(ctx, key, hash).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return removed == 1, nil
+}
+
+func (s *RedisStore) CountRecoveryCodes(ctx context.Context, userID string) (int64, error) {
+	key := fmt.Sprintf("%s%s", recoveryCodesKeyPrefix, userID)
+	count, err := s.client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// SaveMFAChallenge stores a login challenge by its hash until it is
+// answered or expires.
+func (s *RedisStore) SaveMFAChallenge(ctx context.Context, challengeHash, userID string, ttl time.Duration) error {
+	key := fmt.Sprintf("%s%s", mfaChallengeKeyPrefix, challengeHash)
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID, "attempts", 0)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save challenge: %w", err)
+	}
+	return nil
+}
+
+// GetMFAChallengeUser returns the user a challenge belongs to without
+// counting an attempt.
+func (s *RedisStore) GetMFAChallengeUser(ctx context.Context, challengeHash string) (string, error) {
+	key := fmt.Sprintf("%s%s", mfaChallengeKeyPrefix, challengeHash)
+	userID, err := s.client.HGet(ctx, key, "user_id").Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrMFAChallengeInvalid
+		}
+		return "", fmt.Errorf("failed to get challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// AttemptMFAChallenge counts an attempt at a challenge and returns the user
+// it belongs to along with the number of attempts so far.
+func (s *RedisStore) AttemptMFAChallenge(ctx context.Context, challengeHash string) (string, int64, error) {
+	key := fmt.Sprintf("%s%s", mfaChallengeKeyPrefix, challengeHash)
+	result, err := attemptMFAChallengeScript.Run(ctx, s.client, []string{key}).Slice()
+	if err != nil {
+		if err == redis.Nil {
+			return "", 0, ErrMFAChallengeInvalid
+		}
+		return "", 0, fmt.Errorf("failed to check challenge: %w", err)
+	}
+
+	userID, _ := result[0].(string)
+	attempts, _ := result[1].(int64)
+	return userID, attempts, nil
+}
+
+func (s *RedisStore) DeleteMFAChallenge(ctx context.Context, challengeHash string) error {
+	key := fmt.Sprintf("%s%s", mfaChallengeKeyPrefix, challengeHash)
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete challenge: %w", err)
+	}
+	return nil
+}
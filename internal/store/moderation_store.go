@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	moderationRulesKeyPrefix  = "moderation_rules:"
+	moderationRepeatKeyPrefix = "moderation_repeat:"
+	groupMuteKeyPrefix        = "group_mute:"
+	moderationFlagsKey        = "moderation_flags"
+	pendingFlagKeyPrefix      = "moderation_pending_flag:"
+
+	// ModerationRulesChannel carries the scope of rules that changed so every
+	// node can reload them.
+	ModerationRulesChannel = "moderation_rules"
+)
+
+// GetModerationRules returns the rules for a scope, or an empty rule set if
+// none were saved.
+func (s *RedisStore) GetModerationRules(ctx context.Context, scope string) (*models.ModerationRules, error) {
+	key := fmt.Sprintf("%s%s", moderationRulesKeyPrefix, scope)
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return &models.ModerationRules{Rules: []models.ModerationRule{}}, nil
+		}
+		return nil, fmt.Errorf("failed to get moderation rules: %w", err)
+	}
+
+	var rules models.ModerationRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal moderation rules: %w", err)
+	}
+	return &rules, nil
+}
+
+// SaveModerationRules replaces the rules for a scope and notifies every node.
+func (s *RedisStore) SaveModerationRules(ctx context.Context, scope string, rules *models.ModerationRules) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation rules: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%s", moderationRulesKeyPrefix, scope)
+	if err := s.client.Set(ctx, key, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save moderation rules: %w", err)
+	}
+	if err := s.client.Publish(ctx, ModerationRulesChannel, scope).Err(); err != nil {
+		return fmt.Errorf("failed to publish moderation rules update: %w", err)
+	}
+	return nil
+}
+
+// CountRepeatedMessage records one more message with the given fingerprint
+// from the sender and returns how many were sent within the window.
+func (s *RedisStore) CountRepeatedMessage(ctx context.Context, scope, senderID, fingerprint string, window time.Duration) (int64, error) {
+	key := fmt.Sprintf("%s%s:%s:%s", moderationRepeatKeyPrefix, scope, senderID, fingerprint)
+
+	pipe := s.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count repeated message: %w", err)
+	}
+	return count.Val(), nil
+}
+
+func (s *RedisStore) MuteGroupMember(ctx context.Context, groupID, userID string, duration time.Duration) error {
+	key := fmt.Sprintf("%s%s:%s", groupMuteKeyPrefix, groupID, userID)
+	if err := s.client.Set(ctx, key, time.Now().Add(duration).UnixMilli(), duration).Err(); err != nil {
+		return fmt.Errorf("failed to mute group member: %w", err)
+	}
+	return nil
+}
+
+// GetGroupMute returns when the user's mute in the group ends, or nil if the
+// user is not muted.
+func (s *RedisStore) GetGroupMute(ctx context.Context, groupID, userID string) (*time.Time, error) {
+	key := fmt.Sprintf("%s%s:%s", groupMuteKeyPrefix, groupID, userID)
+	until, err := s.client.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group mute: %w", err)
+	}
+
+	t := time.UnixMilli(until)
+	return &t, nil
+}
+
+// SavePendingFlag holds the rules that flagged a message until the message
+// is saved and the flag can be recorded.
+func (s *RedisStore) SavePendingFlag(ctx context.Context, messageID, rules string, ttl time.Duration) error {
+	key := fmt.Sprintf("%s%s", pendingFlagKeyPrefix, messageID)
+	if err := s.client.Set(ctx, key, rules, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save pending flag: %w", err)
+	}
+	return nil
+}
+
+// TakePendingFlag returns and forgets the rules that flagged a message, or ""
+// if none did.
+func (s *RedisStore) TakePendingFlag(ctx context.Context, messageID string) (string, error) {
+	key := fmt.Sprintf("%s%s", pendingFlagKeyPrefix, messageID)
+	rules, err := s.client.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to take pending flag: %w", err)
+	}
+	return rules, nil
+}
+
+// FlagMessage adds a flagged message to the review list. Flagging the same
+// message again keeps the first flag.
+func (s *RedisStore) FlagMessage(ctx context.Context, flag *models.ModerationFlag) error {
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation flag: %w", err)
+	}
+
+	added, err := s.client.HSetNX(ctx, moderationFlagsKey+":data", flag.MessageID, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	if !added {
+		return nil
+	}
+
+	z := &redis.Z{Score: float64(flag.FlaggedAt.UnixMilli()), Member: flag.MessageID}
+	if err := s.client.ZAdd(ctx, moderationFlagsKey, z).Err(); err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	return nil
+}
+
+// GetModerationFlags returns a page of flags, newest first. Each flag carries
+// the message as it was when flagged.
+func (s *RedisStore) GetModerationFlags(ctx context.Context, offset, limit int64) ([]*models.ModerationFlag, error) {
+	messageIDs, err := s.client.ZRevRange(ctx, moderationFlagsKey, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation flags: %w", err)
+	}
+	if len(messageIDs) == 0 {
+		return []*models.ModerationFlag{}, nil
+	}
+
+	flagDataList, err := s.client.HMGet(ctx, moderationFlagsKey+":data", messageIDs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation flags: %w", err)
+	}
+
+	flags := make([]*models.ModerationFlag, 0, len(messageIDs))
+	for _, flagData := range flagDataList {
+		raw, ok := flagData.(string)
+		if !ok {
+			continue
+		}
+
+		var flag models.ModerationFlag
+		if err := json.Unmarshal([]byte(raw), &flag); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal moderation flag: %w", err)
+		}
+		flags = append(flags, &flag)
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var (
+	ErrAlreadyPinned   = errors.New("message is already pinned")
+	ErrNotPinned       = errors.New("message is not pinned")
+	ErrPinLimitReached = errors.New("pin limit reached for this conversation")
+)
+
+const pinsKeyPrefix = "pins:"
+
+// pinScript adds a pin only while the conversation is below its cap, so
+// concurrent pins cannot push it over the limit.
+var pinScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[4]) then
+	return -1
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return 1
+`)
+
+func pinKeys(conversationID string) (string, string) {
+	key := fmt.Sprintf("%s%s", pinsKeyPrefix, conversationID)
+	return key, key + ":data"
+}
+
+func (s *RedisStore) PinMessage(ctx context.Context, conversationID string, pin *models.Pin, limit int) error {
+	pinData, err := json.Marshal(pin)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pin: %w", err)
+	}
+
+	orderKey, dataKey := pinKeys(conversationID)
+	res, err := pinScript.Run(ctx, s.client, []string{orderKey, dataKey},
+		pin.MessageID, pin.PinnedAt.UnixMilli(), pinData, limit).Int()
+	if err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	switch res {
+	case 0:
+		return ErrAlreadyPinned
+	case -1:
+		return ErrPinLimitReached
+	}
+	return nil
+}
+
+func (s *RedisStore) UnpinMessage(ctx context.Context, conversationID, messageID string) error {
+	orderKey, dataKey := pinKeys(conversationID)
+
+	pipe := s.client.TxPipeline()
+	pipe.ZRem(ctx, orderKey, messageID)
+	removed := pipe.HDel(ctx, dataKey, messageID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+
+	if removed.Val() == 0 {
+		return ErrNotPinned
+	}
+	return nil
+}
+
+// GetPins returns the pins of a conversation, oldest first, with the pinned
+// message bodies attached.
+func (s *RedisStore) GetPins(ctx context.Context, conversationID string) ([]*models.Pin, error) {
+	orderKey, dataKey := pinKeys(conversationID)
+
+	messageIDs, err := s.client.ZRange(ctx, orderKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pins: %w", err)
+	}
+	if len(messageIDs) == 0 {
+		return []*models.Pin{}, nil
+	}
+
+	pinDataList, err := s.client.HMGet(ctx, dataKey, messageIDs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pins: %w", err)
+	}
+
+	pins := make([]*models.Pin, 0, len(messageIDs))
+	for i, pinData := range pinDataList {
+		raw, ok := pinData.(string)
+		if !ok {
+			continue
+		}
+
+		var pin models.Pin
+		if err := json.Unmarshal([]byte(raw), &pin); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal pin: %w", err)
+		}
+
+		pin.Message, err = s.GetMessage(ctx, messageIDs[i])
+		if err != nil {
+			log.Printf("failed to get pinned message %s: %v", messageIDs[i], err)
+			continue
+		}
+		pins = append(pins, &pin)
+	}
+
+	return pins, nil
+}
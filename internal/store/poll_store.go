@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const pollKeyPrefix = "poll:"
+
+// voteScript replaces a user's previous vote, if any, and updates the tally
+// in one atomic step.
+var voteScript = redis.NewScript(`
+local prev = redis.call('HGET', KEYS[1], ARGV[1])
+if prev then
+	for _, opt in ipairs(cjson.decode(prev)) do
+		redis.call('HINCRBY', KEYS[2], tostring(opt), -1)
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+for i = 3, #ARGV do
+	redis.call('HINCRBY', KEYS[2], ARGV[i], 1)
+end
+return 1
+`)
+
+func pollKeys(messageID string) (string, string) {
+	key := fmt.Sprintf("%s%s", pollKeyPrefix, messageID)
+	return key + ":votes", key + ":tally"
+}
+
+// VotePoll records userID's vote, replacing any earlier vote. The options
+// must already be validated against the poll.
+func (s *RedisStore) VotePoll(ctx context.Context, messageID, userID string, options []int) error {
+	voteData, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vote: %w", err)
+	}
+
+	args := []interface{}{userID, voteData}
+	for _, opt := range options {
+		args = append(args, strconv.Itoa(opt))
+	}
+
+	votesKey, tallyKey := pollKeys(messageID)
+	if err := voteScript.Run(ctx, s.client, []string{votesKey, tallyKey}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to record vote: %w", err)
+	}
+	return nil
+}
+
+// GetPollResults returns the current tallies of a poll message. MyVote is set
+// from userID's vote when userID is not empty.
+func (s *RedisStore) GetPollResults(ctx context.Context, msg *models.Message, userID string) (*models.PollResults, error) {
+	if msg.Poll == nil {
+		return nil, models.ErrNotAPoll
+	}
+	votesKey, tallyKey := pollKeys(msg.ID)
+
+	pipe := s.client.Pipeline()
+	tally := pipe.HGetAll(ctx, tallyKey)
+	votes := pipe.HGetAll(ctx, votesKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get poll results: %w", err)
+	}
+
+	results := &models.PollResults{
+		Counts: make([]int64, len(msg.Poll.Options)),
+	}
+	for field, value := range tally.Val() {
+		opt, err := strconv.Atoi(field)
+		if err != nil || opt < 0 || opt >= len(results.Counts) {
+			continue
+		}
+		results.Counts[opt], _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	if !msg.Poll.Anonymous {
+		results.Voters = make([][]string, len(msg.Poll.Options))
+		for i := range results.Voters {
+			results.Voters[i] = []string{}
+		}
+	}
+
+	for voterID, voteData := range votes.Val() {
+		var vote []int
+		if err := json.Unmarshal([]byte(voteData), &vote); err != nil {
+			continue
+		}
+		results.TotalVoters++
+		if voterID == userID {
+			results.MyVote = vote
+		}
+		if results.Voters != nil {
+			for _, opt := range vote {
+				if opt >= 0 && opt < len(results.Voters) {
+					results.Voters[opt] = append(results.Voters[opt], voterID)
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
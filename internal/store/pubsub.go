@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 
@@ -34,6 +35,37 @@ func (s *RedisStore) PublishMessage(ctx context.Context, msg *models.Message) er
 	return nil
 }
 
+// PublishEvent delivers an event to every channel whose subscribers take part
+// in the event's conversation: the group channel for groups, both users'
+// channels for private chats and the broadcast channel otherwise.
+func (s *RedisStore) PublishEvent(ctx context.Context, event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	pipe := s.client.Pipeline()
+	for _, channel := range conversationChannels(event.ConversationID) {
+		pipe.Publish(ctx, channel, data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func conversationChannels(conversationID string) []string {
+	parts := strings.Split(conversationID, ":")
+	switch {
+	case parts[0] == "group" && len(parts) == 2:
+		return []string{fmt.Sprintf("group:%s", parts[1])}
+	case parts[0] == "private" && len(parts) == 3:
+		return []string{fmt.Sprintf("user:%s", parts[1]), fmt.Sprintf("user:%s", parts[2])}
+	default:
+		return []string{"broadcast"}
+	}
+}
+
 func (s *RedisStore) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
 	return s.client.Subscribe(ctx, channels...)
 }
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const rateLimitKeyPrefix = "ratelimit:"
+
+// takeTokenScript implements a token bucket that holds up to capacity tokens
+// and refills at rate tokens per millisecond. It uses the Redis clock so all
+// nodes share one notion of time.
+//
+// KEYS: bucket hash
+// ARGV: capacity, rate
+// Returns: allowed (0/1), tokens left, ms until a token is available, ms
+// until the bucket is full
+var takeTokenScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // Until the next request is allowed, when denied
+	ResetAfter time.Duration // Until the bucket is full again
+}
+
+// TakeToken takes a token from the named bucket, which holds up to capacity
+// tokens and refills completely over period.
+func (s *RedisStore) TakeToken(ctx context.Context, bucket string, capacity int, period time.Duration) (*RateLimitResult, error) {
+	key := fmt.Sprintf("%s%s", rateLimitKeyPrefix, bucket)
+	rate := float64(capacity) / float64(period.Milliseconds())
+
+	res, err := takeTokenScript.Run(ctx, s.client, []string{key}, capacity, rate).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return &RateLimitResult{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		ResetAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+const (
+	refreshTokenKeyPrefix  = "refresh_token:"
+	refreshFamilyKeyPrefix = "refresh_family:"
+)
+
+// rotateRefreshTokenScript marks a refresh token as used and returns its
+// owner and the token version its family was issued with. Using a token
+// twice means it leaked, so the whole family is revoked. Used tokens are
+// kept until they expire so reuse can be detected.
+//
+// KEYS: token hash
+// ARGV: family key prefix
+// Returns: {status, user ID, family ID, version} where status is "ok",
+// "invalid" or "reused"
+var rotateRefreshTokenScript = redis.NewScript(`
+local token = redis.call('HMGET', KEYS[1], 'user_id', 'family_id', 'used')
+if not token[1] then
+	return {'invalid', '', '', '0'}
+end
+local familyKey = ARGV[1] .. token[2]
+if token[3] == '1' then
+	redis.call('DEL', familyKey)
+	return {'reused', token[1], token[2], '0'}
+end
+local version = redis.call('GET', familyKey)
+if not version then
+	return {'invalid', token[1], token[2], '0'}
+end
+redis.call('HSET', KEYS[1], 'used', '1')
+return {'ok', token[1], token[2], version}
+`)
+
+// SaveRefreshToken stores a refresh token by its hash and keeps its family
+// alive for at least as long as the token. The family remembers the token
+// version it was issued with.
+func (s *RedisStore) SaveRefreshToken(ctx context.Context, tokenHash, userID, familyID string, version int64, ttl time.Duration) error {
+	tokenKey := fmt.Sprintf("%s%s", refreshTokenKeyPrefix, tokenHash)
+	familyKey := fmt.Sprintf("%s%s", refreshFamilyKeyPrefix, familyID)
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, tokenKey, "user_id", userID, "family_id", familyID, "used", "0")
+	pipe.Expire(ctx, tokenKey, ttl)
+	pipe.Set(ctx, familyKey, version, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return nil
+}
+
+type RefreshTokenFamily struct {
+	UserID   string
+	FamilyID string
+	Version  int64
+}
+
+// RotateRefreshToken consumes a refresh token and returns its family. It
+// returns ErrRefreshTokenReused, after revoking the family, if the token was
+// already used.
+func (s *RedisStore) RotateRefreshToken(ctx context.Context, tokenHash string) (*RefreshTokenFamily, error) {
+	tokenKey := fmt.Sprintf("%s%s", refreshTokenKeyPrefix, tokenHash)
+	res, err := rotateRefreshTokenScript.Run(ctx, s.client, []string{tokenKey}, refreshFamilyKeyPrefix).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	version, _ := strconv.ParseInt(res[3], 10, 64)
+	family := &RefreshTokenFamily{UserID: res[1], FamilyID: res[2], Version: version}
+	switch res[0] {
+	case "ok":
+		return family, nil
+	case "reused":
+		return family, ErrRefreshTokenReused
+	default:
+		return nil, ErrRefreshTokenInvalid
+	}
+}
+
+func (s *RedisStore) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	familyKey := fmt.Sprintf("%s%s", refreshFamilyKeyPrefix, familyID)
+	if err := s.client.Del(ctx, familyKey).Err(); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
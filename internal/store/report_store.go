@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var (
+	ErrReportNotFound = errors.New("report not found")
+	ErrReportResolved = errors.New("report is already resolved")
+)
+
+const (
+	reportsDataKey      = "reports:data"
+	reportsStatusPrefix = "reports:status:"
+	reportsOpenByPrefix = "reports:open_by:"
+)
+
+// resolveReportScript moves a report out of the open queue. Removing it from
+// the open set is the claim, so a report is resolved exactly once.
+//
+// KEYS: open set, resolved set, data hash, reporter's open reports hash
+// ARGV: report ID, score, report JSON, report target
+var resolveReportScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+redis.call('HDEL', KEYS[4], ARGV[4])
+return 1
+`)
+
+// reopenReportScript puts a resolved report back in the open queue. The
+// reporter's open report on the same target is restored unless they have
+// filed a new one since.
+//
+// KEYS: open set, resolved set, data hash, reporter's open reports hash
+// ARGV: report ID, score, report JSON, report target
+var reopenReportScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+redis.call('HSETNX', KEYS[4], ARGV[4], ARGV[1])
+return 1
+`)
+
+func reportStatusKey(status models.ReportStatus) string {
+	return fmt.Sprintf("%s%s", reportsStatusPrefix, status)
+}
+
+// CreateReport queues a new report. If the reporter already has an open
+// report on the same target, that report is returned with created false.
+func (s *RedisStore) CreateReport(ctx context.Context, report *models.Report) (*models.Report, bool, error) {
+	openByKey := fmt.Sprintf("%s%s", reportsOpenByPrefix, report.ReporterID)
+	added, err := s.client.HSetNX(ctx, openByKey, report.Target(), report.ID).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create report: %w", err)
+	}
+	if !added {
+		existingID, err := s.client.HGet(ctx, openByKey, report.Target()).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get existing report: %w", err)
+		}
+		existing, err := s.GetReport(ctx, existingID)
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, reportsDataKey, report.ID, data)
+	pipe.ZAdd(ctx, reportStatusKey(report.Status), &redis.Z{
+		Score:  float64(report.CreatedAt.UnixMilli()),
+		Member: report.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to create report: %w", err)
+	}
+	return report, true, nil
+}
+
+func (s *RedisStore) GetReport(ctx context.Context, id string) (*models.Report, error) {
+	data, err := s.client.HGet(ctx, reportsDataKey, id).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrReportNotFound
+		}
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+
+	var report models.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal report: %w", err)
+	}
+	return &report, nil
+}
+
+// GetReports returns a page of reports with the given status. Open reports
+// come oldest first, like a queue; resolved ones newest first.
+func (s *RedisStore) GetReports(ctx context.Context, status models.ReportStatus, offset, limit int64) ([]*models.Report, error) {
+	var ids []string
+	var err error
+	if status == models.ReportOpen {
+		ids, err = s.client.ZRange(ctx, reportStatusKey(status), offset, offset+limit-1).Result()
+	} else {
+		ids, err = s.client.ZRevRange(ctx, reportStatusKey(status), offset, offset+limit-1).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*models.Report{}, nil
+	}
+
+	reportDataList, err := s.client.HMGet(ctx, reportsDataKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+
+	reports := make([]*models.Report, 0, len(ids))
+	for _, reportData := range reportDataList {
+		raw, ok := reportData.(string)
+		if !ok {
+			continue
+		}
+
+		var report models.Report
+		if err := json.Unmarshal([]byte(raw), &report); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal report: %w", err)
+		}
+		reports = append(reports, &report)
+	}
+
+	return reports, nil
+}
+
+// ResolveReport saves a resolved report and moves it out of the open queue.
+// It returns ErrReportResolved if the report was no longer open.
+func (s *RedisStore) ResolveReport(ctx context.Context, report *models.Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	resolved, err := resolveReportScript.Run(ctx, s.client, []string{
+		reportStatusKey(models.ReportOpen),
+		reportStatusKey(report.Status),
+		reportsDataKey,
+		fmt.Sprintf("%s%s", reportsOpenByPrefix, report.ReporterID),
+	}, report.ID, report.ResolvedAt.UnixMilli(), data, report.Target()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to resolve report: %w", err)
+	}
+	if resolved == 0 {
+		return ErrReportResolved
+	}
+	return nil
+}
+
+// ReopenReport undoes ResolveReport for a report that was resolved with the
+// given status, restoring it as it was while open.
+func (s *RedisStore) ReopenReport(ctx context.Context, report *models.Report, resolved models.ReportStatus) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	err = reopenReportScript.Run(ctx, s.client, []string{
+		reportStatusKey(models.ReportOpen),
+		reportStatusKey(resolved),
+		reportsDataKey,
+		fmt.Sprintf("%s%s", reportsOpenByPrefix, report.ReporterID),
+	}, report.ID, report.CreatedAt.UnixMilli(), data, report.Target()).Err()
+	if err != nil {
+		return fmt.Errorf("failed to reopen report: %w", err)
+	}
+	return nil
+}
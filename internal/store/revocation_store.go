@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	revokedTokenKeyPrefix   = "revoked_token:"
+	revokedSessionKeyPrefix = "revoked_session:"
+	tokenVersionKeyPrefix   = "token_version:"
+)
+
+// TokenRevocation is published on a user's revocation channel so every node
+// can close the WebSockets of revoked sessions. Connections match it by
+// token ID, session ID, or a token version below MinVersion.
+type TokenRevocation struct {
+	TokenID    string `json:"token_id,omitempty"`
+	SessionID  string `json:"session_id,omitempty"`
+	MinVersion int64  `json:"min_version,omitempty"`
+}
+
+func RevocationChannel(userID string) string {
+	return fmt.Sprintf("revoked:%s", userID)
+}
+
+// RevokeToken denies an access token until it expires.
+func (s *RedisStore) RevokeToken(ctx context.Context, userID, tokenID, sessionID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl > 0 {
+		key := fmt.Sprintf("%s%s", revokedTokenKeyPrefix, tokenID)
+		if err := s.client.Set(ctx, key, userID, ttl).Err(); err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+	}
+
+	return s.publishRevocation(ctx, userID, &TokenRevocation{TokenID: tokenID, SessionID: sessionID})
+}
+
+// RevokeSession denies every access token issued for a session. Access
+// tokens live at most ttl, so the denial expires after it.
+func (s *RedisStore) RevokeSession(ctx context.Context, userID, sessionID string, ttl time.Duration) error {
+	key := fmt.Sprintf("%s%s", revokedSessionKeyPrefix, sessionID)
+	if err := s.client.Set(ctx, key, userID, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return s.publishRevocation(ctx, userID, &TokenRevocation{SessionID: sessionID})
+}
+
+// RevokeUserTokens invalidates every token issued to the user so far by
+// bumping the user's token version.
+func (s *RedisStore) RevokeUserTokens(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("%s%s", tokenVersionKeyPrefix, userID)
+	version, err := s.client.Incr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	return s.publishRevocation(ctx, userID, &TokenRevocation{MinVersion: version})
+}
+
+// GetTokenVersion returns the version new tokens for the user must carry.
+func (s *RedisStore) GetTokenVersion(ctx context.Context, userID string) (int64, error) {
+	key := fmt.Sprintf("%s%s", tokenVersionKeyPrefix, userID)
+	version, err := s.client.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return version, nil
+}
+
+// IsTokenRevoked reports whether an access token was revoked on its own,
+// with its session or by a log out everywhere.
+func (s *RedisStore) IsTokenRevoked(ctx context.Context, userID, tokenID, sessionID string, version int64) (bool, error) {
+	pipe := s.client.Pipeline()
+	denied := pipe.Exists(ctx,
+		fmt.Sprintf("%s%s", revokedTokenKeyPrefix, tokenID),
+		fmt.Sprintf("%s%s", revokedSessionKeyPrefix, sessionID))
+	current := pipe.Get(ctx, fmt.Sprintf("%s%s", tokenVersionKeyPrefix, userID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	if denied.Val() > 0 {
+		return true, nil
+	}
+	currentVersion, err := current.Int64()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return version < currentVersion, nil
+}
+
+func (s *RedisStore) publishRevocation(ctx context.Context, userID string, revocation *TokenRevocation) error {
+	data, err := json.Marshal(revocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation: %w", err)
+	}
+	if err := s.client.Publish(ctx, RevocationChannel(userID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish revocation: %w", err)
+	}
+	return nil
+}
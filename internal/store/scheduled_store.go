@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+
+const (
+	scheduledQueueKey      = "scheduled_messages"
+	scheduledDataKey       = "scheduled_messages:data"
+	scheduledAttemptsKey   = "scheduled_messages:attempts"
+	userScheduledKeyPrefix = "user_scheduled:"
+)
+
+// claimScript pops every message due at or before ARGV[1] (up to ARGV[2]) in
+// a single atomic step, so each message is claimed by exactly one node.
+//
+// KEYS: queue, data hash
+// ARGV: now in milliseconds, limit
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local claimed = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[2], id)
+	redis.call('HDEL', KEYS[2], id)
+	if data then
+		table.insert(claimed, data)
+	end
+end
+return claimed
+`)
+
+// claimScheduledScript is claimScript for scheduled messages, which also
+// returns how many deliveries of each message failed so far.
+//
+// KEYS: queue, data hash, attempts hash
+// ARGV: now in milliseconds, limit
+// Returns: {data, failed attempts, data, failed attempts, ...}
+var claimScheduledScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local claimed = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[2], id)
+	local attempts = redis.call('HGET', KEYS[3], id) or '0'
+	redis.call('HDEL', KEYS[2], id)
+	redis.call('HDEL', KEYS[3], id)
+	if data then
+		table.insert(claimed, data)
+		table.insert(claimed, attempts)
+	end
+end
+return claimed
+`)
+
+var cancelScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[3], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('SREM', KEYS[3], ARGV[1])
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+return 1
+`)
+
+func (s *RedisStore) ScheduleMessage(ctx context.Context, msg *models.Message) error {
+	if msg.SendAt == nil {
+		return fmt.Errorf("message has no send time")
+	}
+
+	msgData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, scheduledDataKey, msg.ID, msgData)
+	pipe.ZAdd(ctx, scheduledQueueKey, &redis.Z{
+		Score:  float64(msg.SendAt.UnixMilli()),
+		Member: msg.ID,
+	})
+	pipe.SAdd(ctx, fmt.Sprintf("%s%s", userScheduledKeyPrefix, msg.FromID), msg.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return nil
+}
+
+// GetScheduledMessages returns the user's pending messages ordered by send
+// time.
+func (s *RedisStore) GetScheduledMessages(ctx context.Context, userID string) ([]*models.Message, error) {
+	userKey := fmt.Sprintf("%s%s", userScheduledKeyPrefix, userID)
+	ids, err := s.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled messages: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*models.Message{}, nil
+	}
+
+	msgDataList, err := s.client.HMGet(ctx, scheduledDataKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled messages: %w", err)
+	}
+
+	messages := make([]*models.Message, 0, len(ids))
+	var stale []interface{}
+	for i, msgData := range msgDataList {
+		raw, ok := msgData.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+
+		var msg models.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		messages = append(messages, &msg)
+	}
+
+	if len(stale) > 0 {
+		s.client.SRem(ctx, userKey, stale...)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SendAt.Before(*messages[j].SendAt)
+	})
+
+	return messages, nil
+}
+
+func (s *RedisStore) CancelScheduledMessage(ctx context.Context, userID, messageID string) error {
+	keys := []string{
+		scheduledQueueKey,
+		scheduledDataKey,
+		fmt.Sprintf("%s%s", userScheduledKeyPrefix, userID),
+		scheduledAttemptsKey,
+	}
+
+	res, err := cancelScript.Run(ctx, s.client, keys, messageID).Int()
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	if res == 0 {
+		return ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// RetryScheduledMessage puts a message whose delivery failed back on the
+// schedule, due again at retryAt. Its SendAt is left as the sender chose.
+func (s *RedisStore) RetryScheduledMessage(ctx context.Context, msg *models.Message, attempts int, retryAt time.Time) error {
+	msgData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, scheduledDataKey, msg.ID, msgData)
+	pipe.HSet(ctx, scheduledAttemptsKey, msg.ID, attempts)
+	pipe.ZAdd(ctx, scheduledQueueKey, &redis.Z{
+		Score:  float64(retryAt.UnixMilli()),
+		Member: msg.ID,
+	})
+	pipe.SAdd(ctx, fmt.Sprintf("%s%s", userScheduledKeyPrefix, msg.FromID), msg.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to reschedule message: %w", err)
+	}
+	return nil
+}
+
+// ClaimedMessage is a scheduled message claimed for delivery.
+type ClaimedMessage struct {
+	*models.Message
+	Attempts int // Failed deliveries so far
+}
+
+// ClaimDueMessages removes up to limit messages due at or before now from the
+// schedule and returns them. Callers own delivery of the returned messages.
+func (s *RedisStore) ClaimDueMessages(ctx context.Context, now time.Time, limit int64) ([]*ClaimedMessage, error) {
+	res, err := claimScheduledScript.Run(ctx, s.client, []string{scheduledQueueKey, scheduledDataKey, scheduledAttemptsKey},
+		now.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled messages: %w", err)
+	}
+
+	messages := make([]*ClaimedMessage, 0, len(res)/2)
+	pipe := s.client.Pipeline()
+	for i := 0; i+1 < len(res); i += 2 {
+		var msg models.Message
+		if err := json.Unmarshal([]byte(res[i]), &msg); err != nil {
+			log.Printf("dropping malformed scheduled message: %v", err)
+			continue
+		}
+		attempts, _ := strconv.Atoi(res[i+1])
+		messages = append(messages, &ClaimedMessage{Message: &msg, Attempts: attempts})
+		pipe.SRem(ctx, fmt.Sprintf("%s%s", userScheduledKeyPrefix, msg.FromID), msg.ID)
+	}
+
+	if len(messages) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("failed to update scheduled message index: %v", err)
+		}
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func newScheduledMessage(sendAt time.Time) *models.Message {
+	msg := models.NewMessage(string(models.MessageTypePrivate), "hi", "alice", "alice")
+	msg.ToID = "bob"
+	msg.SendAt = &sendAt
+	return msg
+}
+
+func TestClaimDueMessages(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	due := newScheduledMessage(now.Add(-time.Minute))
+	later := newScheduledMessage(now.Add(time.Hour))
+	for _, msg := range []*models.Message{due, later} {
+		if err := s.ScheduleMessage(ctx, msg); err != nil {
+			t.Fatalf("ScheduleMessage() error = %v", err)
+		}
+	}
+
+	claimed, err := s.ClaimDueMessages(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ClaimDueMessages() error = %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != due.ID || claimed[0].Attempts != 0 {
+		t.Fatalf("ClaimDueMessages() = %+v, want only %s with no attempts", claimed, due.ID)
+	}
+
+	again, err := s.ClaimDueMessages(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ClaimDueMessages() error = %v", err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("second ClaimDueMessages() = %d messages, want 0", len(again))
+	}
+
+	pending, err := s.GetScheduledMessages(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetScheduledMessages() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != later.ID {
+		t.Fatalf("GetScheduledMessages() = %+v, want only %s", pending, later.ID)
+	}
+}
+
+func TestRetryScheduledMessage(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	msg := newScheduledMessage(now.Add(-time.Minute))
+	if err := s.RetryScheduledMessage(ctx, msg, 3, now.Add(time.Minute)); err != nil {
+		t.Fatalf("RetryScheduledMessage() error = %v", err)
+	}
+
+	if claimed, _ := s.ClaimDueMessages(ctx, now, 10); len(claimed) != 0 {
+		t.Fatalf("claimed %d messages before the retry was due", len(claimed))
+	}
+
+	claimed, err := s.ClaimDueMessages(ctx, now.Add(2*time.Minute), 10)
+	if err != nil {
+		t.Fatalf("ClaimDueMessages() error = %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].Attempts != 3 {
+		t.Fatalf("ClaimDueMessages() = %+v, want one message with 3 attempts", claimed)
+	}
+	if !claimed[0].SendAt.Equal(*msg.SendAt) {
+		t.Errorf("SendAt = %v, want %v", claimed[0].SendAt, msg.SendAt)
+	}
+}
+
+func TestCancelScheduledMessage(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	msg := newScheduledMessage(time.Now().Add(time.Hour))
+	if err := s.ScheduleMessage(ctx, msg); err != nil {
+		t.Fatalf("ScheduleMessage() error = %v", err)
+	}
+
+	if err := s.CancelScheduledMessage(ctx, "bob", msg.ID); err != ErrScheduledMessageNotFound {
+		t.Errorf("cancel by another user error = %v, want %v", err, ErrScheduledMessageNotFound)
+	}
+	if err := s.CancelScheduledMessage(ctx, "alice", msg.ID); err != nil {
+		t.Fatalf("CancelScheduledMessage() error = %v", err)
+	}
+	if err := s.CancelScheduledMessage(ctx, "alice", msg.ID); err != ErrScheduledMessageNotFound {
+		t.Errorf("second cancel error = %v, want %v", err, ErrScheduledMessageNotFound)
+	}
+}
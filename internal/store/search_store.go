@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+	"github.com/bm-197/go-chat/internal/search"
+)
+
+const (
+	searchKeyPrefix     = "search:"
+	dmPartnersKeyPrefix = "dm_partners:"
+
+	// maxSearchScan bounds how many index entries a single query reads
+	// across all conversations, so a query matching nothing can't walk
+	// every index.
+	maxSearchScan = 5000
+
+	// searchPageSize is how many index entries a search reads at a time.
+	searchPageSize = 200
+)
+
+// SearchQuery describes a full-text search. Every term must match. Zero
+// Since/Until leave the date range open.
+type SearchQuery struct {
+	Terms           []string
+	ConversationIDs []string
+	FromID          string
+	Since           time.Time
+	Until           time.Time
+	HasAttachments  bool
+	Limit           int
+}
+
+// The inverted index keeps one sorted set per conversation and term, scored
+// by message time, so a search only ever touches conversations the caller
+// is allowed to read.
+func searchTermKey(conversationID, term string) string {
+	return fmt.Sprintf("%s%s:%s", searchKeyPrefix, conversationID, term)
+}
+
+func indexMessage(ctx context.Context, pipe redis.Pipeliner, msg *models.Message) {
+	z := &redis.Z{Score: float64(msg.Timestamp.UnixMilli()), Member: msg.ID}
+	conversationID := msg.ConversationID()
+	for _, term := range search.MessageTokens(msg) {
+		pipe.ZAdd(ctx, searchTermKey(conversationID, term), z)
+	}
+
+	if msg.Type == models.MessageTypePrivate {
+		pipe.SAdd(ctx, fmt.Sprintf("%s%s", dmPartnersKeyPrefix, msg.FromID), msg.ToID)
+		pipe.SAdd(ctx, fmt.Sprintf("%s%s", dmPartnersKeyPrefix, msg.ToID), msg.FromID)
+	}
+}
+
+func unindexMessage(ctx context.Context, pipe redis.Pipeliner, msg *models.Message) {
+	conversationID := msg.ConversationID()
+	for _, term := range search.MessageTokens(msg) {
+		pipe.ZRem(ctx, searchTermKey(conversationID, term), msg.ID)
+	}
+}
+
+// GetPrivatePartners returns the IDs of users the given user has exchanged
+// private messages with.
+func (s *RedisStore) GetPrivatePartners(ctx context.Context, userID string) ([]string, error) {
+	partners, err := s.client.SMembers(ctx, fmt.Sprintf("%s%s", dmPartnersKeyPrefix, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private partners: %w", err)
+	}
+	return partners, nil
+}
+
+// SearchMessages returns messages from q.ConversationIDs matching every term,
+// newest first.
+func (s *RedisStore) SearchMessages(ctx context.Context, q SearchQuery) ([]*models.Message, error) {
+	if len(q.Terms) == 0 || len(q.ConversationIDs) == 0 {
+		return []*models.Message{}, nil
+	}
+
+	scoreRange := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !q.Since.IsZero() {
+		scoreRange.Min = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+	if !q.Until.IsZero() {
+		scoreRange.Max = strconv.FormatInt(q.Until.UnixMilli(), 10)
+	}
+
+	// Each conversation is scanned through its rarest term's index, newest
+	// first, so a common term doesn't pull in its whole history.
+	pipe := s.client.Pipeline()
+	counts := make([][]*redis.IntCmd, len(q.ConversationIDs))
+	for i, conversationID := range q.ConversationIDs {
+		for _, term := range q.Terms {
+			counts[i] = append(counts[i], pipe.ZCount(ctx, searchTermKey(conversationID, term), scoreRange.Min, scoreRange.Max))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	var results []*models.Message
+	budget := int64(maxSearchScan)
+	for i, conversationID := range q.ConversationIDs {
+		if budget <= 0 {
+			break
+		}
+
+		terms := make([]termCount, len(q.Terms))
+		for j, term := range q.Terms {
+			terms[j] = termCount{key: searchTermKey(conversationID, term), count: counts[i][j].Val()}
+		}
+		sort.Slice(terms, func(a, b int) bool {
+			return terms[a].count < terms[b].count
+		})
+		if terms[0].count == 0 {
+			continue
+		}
+
+		keys := make([]string, len(terms))
+		for j, term := range terms {
+			keys[j] = term.key
+		}
+		matches, err := s.searchConversation(ctx, q, keys, scoreRange, &budget)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, matches...)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Timestamp.After(results[j].Timestamp)
+	})
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	if results == nil {
+		results = []*models.Message{}
+	}
+
+	return results, nil
+}
+
+type termCount struct {
+	key   string
+	count int64
+}
+
+// searchConversation pages through the first of keys, newest first, and
+// returns up to q.Limit messages that are in every other key too and pass
+// q's sender and attachment filters. Every entry read is charged to budget,
+// and the scan stops once it runs out.
+func (s *RedisStore) searchConversation(ctx context.Context, q SearchQuery, keys []string, scoreRange *redis.ZRangeBy, budget *int64) ([]*models.Message, error) {
+	var matches []*models.Message
+	for offset := int64(0); len(matches) < q.Limit && *budget > 0; {
+		count := min(int64(searchPageSize), *budget)
+		page, err := s.client.ZRevRangeByScore(ctx, keys[0], &redis.ZRangeBy{
+			Min:    scoreRange.Min,
+			Max:    scoreRange.Max,
+			Offset: offset,
+			Count:  count,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to search messages: %w", err)
+		}
+		offset += int64(len(page))
+		*budget -= int64(len(page))
+		if len(page) == 0 {
+			break
+		}
+
+		pipe := s.client.Pipeline()
+		scores := make([][]*redis.FloatCmd, len(page))
+		for i, id := range page {
+			for _, key := range keys[1:] {
+				scores[i] = append(scores[i], pipe.ZScore(ctx, key, id))
+			}
+		}
+		if len(keys) > 1 {
+			if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+				return nil, fmt.Errorf("failed to search messages: %w", err)
+			}
+		}
+
+		ids := make([]string, 0, len(page))
+	entries:
+		for i, id := range page {
+			for _, cmd := range scores[i] {
+				if cmd.Err() != nil {
+					continue entries
+				}
+			}
+			ids = append(ids, id)
+		}
+
+		candidates, err := s.GetMessagesByID(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range candidates {
+			if q.FromID != "" && msg.FromID != q.FromID {
+				continue
+			}
+			if q.HasAttachments && !msg.HasAttachments() {
+				continue
+			}
+			matches = append(matches, msg)
+			if len(matches) == q.Limit {
+				break
+			}
+		}
+
+		if int64(len(page)) < count {
+			break
+		}
+	}
+
+	return matches, nil
+}
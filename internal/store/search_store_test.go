@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestSearchMessages(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+
+	save := func(i int, fromID, content string) *models.Message {
+		msg := models.NewMessage(string(models.MessageTypeGroup), content, fromID, fromID)
+		msg.GroupID = "g1"
+		msg.Timestamp = start.Add(time.Duration(i) * time.Second)
+		if err := s.SaveMessage(ctx, msg); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+		return msg
+	}
+
+	oldest := save(0, "bob", "release notes draft")
+	for i := 1; i <= 3*searchPageSize; i++ {
+		save(i, "alice", "release party")
+	}
+	newest := save(3*searchPageSize+1, "bob", "release notes final")
+
+	conversations := []string{models.GroupConversationID("g1")}
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{
+			name:  "every term must match",
+			query: SearchQuery{Terms: []string{"release", "notes"}, Limit: 10},
+			want:  []string{newest.ID, oldest.ID},
+		},
+		{
+			name:  "sender filter reaches past newer matches",
+			query: SearchQuery{Terms: []string{"release"}, FromID: "bob", Limit: 10},
+			want:  []string{newest.ID, oldest.ID},
+		},
+		{
+			name:  "date range",
+			query: SearchQuery{Terms: []string{"notes"}, Until: start.Add(time.Second), Limit: 10},
+			want:  []string{oldest.ID},
+		},
+		{
+			name:  "limit keeps the newest",
+			query: SearchQuery{Terms: []string{"notes"}, Limit: 1},
+			want:  []string{newest.ID},
+		},
+		{
+			name:  "unknown term",
+			query: SearchQuery{Terms: []string{"release", "nothing"}, Limit: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.ConversationIDs = conversations
+			results, err := s.SearchMessages(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("SearchMessages() error = %v", err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("SearchMessages() = %d messages, want %d", len(results), len(tt.want))
+			}
+			for i, msg := range results {
+				if msg.ID != tt.want[i] {
+					t.Errorf("result %d = %s, want %s", i, msg.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SaveSession stores a session for as long as its refresh token family.
+func (s *RedisStore) SaveSession(ctx context.Context, session *models.Session, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%s", sessionKeyPrefix, session.ID), data, ttl)
+	pipe.SAdd(ctx, fmt.Sprintf("%s%s", userSessionsKeyPrefix, session.UserID), session.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	data, err := s.client.Get(ctx, fmt.Sprintf("%s%s", sessionKeyPrefix, sessionID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &session, nil
+}
+
+// TouchSession records activity on a session from ip and userAgent. A ttl
+// of 0 keeps the session's expiry.
+func (s *RedisStore) TouchSession(ctx context.Context, sessionID, ip, userAgent string, ttl time.Duration) error {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	session.IP = ip
+	session.UserAgent = userAgent
+	session.LastActiveAt = time.Now()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if ttl == 0 {
+		ttl = redis.KeepTTL
+	}
+	if err := s.client.SetXX(ctx, fmt.Sprintf("%s%s", sessionKeyPrefix, sessionID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// GetUserSessions returns the user's live sessions, most recently active
+// first. Sessions whose refresh tokens were revoked, including by a log out
+// everywhere, are dropped.
+func (s *RedisStore) GetUserSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	sessionIDs, err := s.client.SMembers(ctx, fmt.Sprintf("%s%s", userSessionsKeyPrefix, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	version, err := s.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*models.Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		familyVersion, err := s.client.Get(ctx, fmt.Sprintf("%s%s", refreshFamilyKeyPrefix, sessionID)).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get sessions: %w", err)
+		}
+		session, sessionErr := s.GetSession(ctx, sessionID)
+		if sessionErr != nil && !errors.Is(sessionErr, ErrSessionNotFound) {
+			return nil, sessionErr
+		}
+
+		if err == redis.Nil || familyVersion < version || sessionErr != nil {
+			if err := s.DeleteSession(ctx, userID, sessionID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+	})
+	return sessions, nil
+}
+
+func (s *RedisStore) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("%s%s", sessionKeyPrefix, sessionID))
+	pipe.SRem(ctx, fmt.Sprintf("%s%s", userSessionsKeyPrefix, userID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const (
+	signingKeysKey     = "jwt_keys"
+	keyRotationLockKey = "jwt_keys:rotation_lock"
+)
+
+func (s *RedisStore) GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	keyDataMap, err := s.client.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing keys: %w", err)
+	}
+
+	keys := make([]*models.SigningKey, 0, len(keyDataMap))
+	for kid, keyData := range keyDataMap {
+		var key models.SigningKey
+		if err := json.Unmarshal([]byte(keyData), &key); err != nil {
+			log.Printf("skipping malformed signing key %s: %v", kid, err)
+			continue
+		}
+		keys = append(keys, &key)
+	}
+	return keys, nil
+}
+
+func (s *RedisStore) SaveSigningKey(ctx context.Context, key *models.SigningKey) error {
+	keyData, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	if err := s.client.HSet(ctx, signingKeysKey, key.ID, keyData).Err(); err != nil {
+		return fmt.Errorf("failed to save signing key: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) DeleteSigningKeys(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.client.HDel(ctx, signingKeysKey, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to delete signing keys: %w", err)
+	}
+	return nil
+}
+
+// AcquireKeyRotationLock makes sure only one node rotates keys at a time. The
+// lock expires after ttl.
+func (s *RedisStore) AcquireKeyRotationLock(ctx context.Context, ttl time.Duration) (bool, error) {
+	acquired, err := s.client.SetNX(ctx, keyRotationLockKey, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire key rotation lock: %w", err)
+	}
+	return acquired, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+var ErrNotStarred = errors.New("message is not starred")
+
+const (
+	starsKeyPrefix        = "stars:"
+	messageStarsKeyPrefix = "message_stars:" // Users who starred a message
+)
+
+func starKeys(userID string) (string, string) {
+	key := fmt.Sprintf("%s%s", starsKeyPrefix, userID)
+	return key, key + ":data"
+}
+
+func conversationStarsKey(userID, conversationID string) string {
+	return fmt.Sprintf("%s%s:conversation:%s", starsKeyPrefix, userID, conversationID)
+}
+
+// StarMessage adds a star to the user's index. Starring an already starred
+// message keeps the original star.
+func (s *RedisStore) StarMessage(ctx context.Context, userID string, star *models.Star) error {
+	starData, err := json.Marshal(star)
+	if err != nil {
+		return fmt.Errorf("failed to marshal star: %w", err)
+	}
+
+	orderKey, dataKey := starKeys(userID)
+	added, err := s.client.HSetNX(ctx, dataKey, star.MessageID, starData).Result()
+	if err != nil {
+		return fmt.Errorf("failed to star message: %w", err)
+	}
+	if !added {
+		return nil
+	}
+
+	z := &redis.Z{Score: float64(star.StarredAt.UnixMilli()), Member: star.MessageID}
+	pipe := s.client.Pipeline()
+	pipe.ZAdd(ctx, orderKey, z)
+	pipe.ZAdd(ctx, conversationStarsKey(userID, star.ConversationID), z)
+	pipe.SAdd(ctx, fmt.Sprintf("%s%s", messageStarsKeyPrefix, star.MessageID), userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to star message: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) UnstarMessage(ctx context.Context, userID, messageID string) error {
+	orderKey, dataKey := starKeys(userID)
+
+	starData, err := s.client.HGet(ctx, dataKey, messageID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrNotStarred
+		}
+		return fmt.Errorf("failed to get star: %w", err)
+	}
+
+	var star models.Star
+	if err := json.Unmarshal(starData, &star); err != nil {
+		return fmt.Errorf("failed to unmarshal star: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HDel(ctx, dataKey, messageID)
+	pipe.ZRem(ctx, orderKey, messageID)
+	pipe.ZRem(ctx, conversationStarsKey(userID, star.ConversationID), messageID)
+	pipe.SRem(ctx, fmt.Sprintf("%s%s", messageStarsKeyPrefix, messageID), userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to unstar message: %w", err)
+	}
+	return nil
+}
+
+// GetStars returns a page of the user's stars, newest first, optionally
+// limited to one conversation. Each star carries the current message, or
+// Deleted when the message is gone.
+func (s *RedisStore) GetStars(ctx context.Context, userID, conversationID string, offset, limit int64) ([]*models.Star, error) {
+	orderKey, dataKey := starKeys(userID)
+	if conversationID != "" {
+		orderKey = conversationStarsKey(userID, conversationID)
+	}
+
+	messageIDs, err := s.client.ZRevRange(ctx, orderKey, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stars: %w", err)
+	}
+	if len(messageIDs) == 0 {
+		return []*models.Star{}, nil
+	}
+
+	starDataList, err := s.client.HMGet(ctx, dataKey, messageIDs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stars: %w", err)
+	}
+
+	stars := make([]*models.Star, 0, len(messageIDs))
+	for _, starData := range starDataList {
+		raw, ok := starData.(string)
+		if !ok {
+			continue
+		}
+
+		var star models.Star
+		if err := json.Unmarshal([]byte(raw), &star); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal star: %w", err)
+		}
+
+		star.Message, err = s.GetMessage(ctx, star.MessageID)
+		if errors.Is(err, ErrMessageNotFound) {
+			star.Deleted = true
+		} else if err != nil {
+			return nil, err
+		}
+		stars = append(stars, &star)
+	}
+
+	return stars, nil
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+const suspensionKeyPrefix = "user_suspension:"
+
+var ErrSuspensionEnded = errors.New("suspension must end in the future")
+
+// SuspendUser suspends a user, replacing any earlier suspension. Timed
+// suspensions lift themselves when they end.
+func (s *RedisStore) SuspendUser(ctx context.Context, suspension *models.Suspension) error {
+	data, err := json.Marshal(suspension)
+	if err != nil {
+		return fmt.Errorf("failed to marshal suspension: %w", err)
+	}
+
+	var ttl time.Duration
+	if suspension.Until != nil {
+		ttl = time.Until(*suspension.Until)
+		if ttl <= 0 {
+			return ErrSuspensionEnded
+		}
+	}
+
+	key := fmt.Sprintf("%s%s", suspensionKeyPrefix, suspension.UserID)
+	if err := s.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to suspend user: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) LiftSuspension(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("%s%s", suspensionKeyPrefix, userID)
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to lift suspension: %w", err)
+	}
+	return nil
+}
+
+// GetSuspension returns the user's active suspension, or nil if there is
+// none.
+func (s *RedisStore) GetSuspension(ctx context.Context, userID string) (*models.Suspension, error) {
+	key := fmt.Sprintf("%s%s", suspensionKeyPrefix, userID)
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get suspension: %w", err)
+	}
+
+	var suspension models.Suspension
+	if err := json.Unmarshal(data, &suspension); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal suspension: %w", err)
+	}
+	return &suspension, nil
+}
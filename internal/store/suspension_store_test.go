@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestSuspendUser(t *testing.T) {
+	s, mr := newTestStore(t)
+	ctx := context.Background()
+
+	ended := time.Now().Add(-time.Minute)
+	if err := s.SuspendUser(ctx, &models.Suspension{UserID: "u1", Until: &ended}); err != ErrSuspensionEnded {
+		t.Errorf("SuspendUser(ended) error = %v, want %v", err, ErrSuspensionEnded)
+	}
+
+	until := time.Now().Add(time.Hour)
+	if err := s.SuspendUser(ctx, &models.Suspension{UserID: "u1", Reason: "spam", Until: &until}); err != nil {
+		t.Fatalf("SuspendUser() error = %v", err)
+	}
+	suspension, err := s.GetSuspension(ctx, "u1")
+	if err != nil || suspension == nil || suspension.Reason != "spam" {
+		t.Fatalf("GetSuspension() = %+v, %v; want the suspension", suspension, err)
+	}
+
+	// Timed suspensions lift themselves.
+	mr.FastForward(time.Hour + time.Second)
+	if suspension, err := s.GetSuspension(ctx, "u1"); err != nil || suspension != nil {
+		t.Errorf("GetSuspension() after it ended = %+v, %v; want none", suspension, err)
+	}
+
+	if err := s.SuspendUser(ctx, &models.Suspension{UserID: "u1"}); err != nil {
+		t.Fatalf("SuspendUser(indefinite) error = %v", err)
+	}
+	if err := s.LiftSuspension(ctx, "u1"); err != nil {
+		t.Fatalf("LiftSuspension() error = %v", err)
+	}
+	if suspension, err := s.GetSuspension(ctx, "u1"); err != nil || suspension != nil {
+		t.Errorf("GetSuspension() after lifting = %+v, %v; want none", suspension, err)
+	}
+}
@@ -17,7 +17,7 @@ const (
 
 func (s *RedisStore) SaveUser(ctx context.Context, user *models.User) error {
 	userKey := fmt.Sprintf("%s%s", userKeyPrefix, user.ID)
-	userData, err := json.Marshal(user)
+	userData, err := marshalUser(user)
 	if err != nil {
 		return fmt.Errorf("failed to marshal user: %w", err)
 	}
@@ -44,6 +44,126 @@ func (s *RedisStore) SaveUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// maxUserUpdateAttempts bounds how often updateUser retries when the user
+// changes while it is being updated.
+const maxUserUpdateAttempts = 5
+
+// storedUser is how users are kept in Redis. Unlike the JSON sent to
+// clients, it includes the password hash.
+type storedUser struct {
+	models.User
+	Password string `json:"password,omitempty"`
+}
+
+func marshalUser(user *models.User) ([]byte, error) {
+	return json.Marshal(&storedUser{User: *user, Password: user.Password})
+}
+
+func unmarshalUser(data []byte) (*models.User, error) {
+	var stored storedUser
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	user := stored.User
+	user.Password = stored.Password
+	return &user, nil
+}
+
+// updateUser applies update to the stored user and saves the result, unless
+// update returns false. Fields update doesn't touch keep their stored
+// values even if they change concurrently. It reports whether the user was
+// saved.
+func (s *RedisStore) updateUser(ctx context.Context, userID string, update func(*models.User) bool) (bool, error) {
+	userKey := fmt.Sprintf("%s%s", userKeyPrefix, userID)
+
+	for attempt := 0; attempt < maxUserUpdateAttempts; attempt++ {
+		updated := false
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			userData, err := tx.Get(ctx, userKey).Bytes()
+			if err != nil {
+				if err == redis.Nil {
+					return fmt.Errorf("user not found")
+				}
+				return err
+			}
+
+			user, err := unmarshalUser(userData)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal user: %w", err)
+			}
+			if !update(user) {
+				return nil
+			}
+
+			userData, err = marshalUser(user)
+			if err != nil {
+				return fmt.Errorf("failed to marshal user: %w", err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, userKey, userData, 0)
+				return nil
+			})
+			updated = err == nil
+			return err
+		}, userKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to update user: %w", err)
+		}
+		return updated, nil
+	}
+
+	return false, fmt.Errorf("failed to update user: too many concurrent changes")
+}
+
+// ReplacePassword sets a user's password hash to newHash if it is still
+// oldHash. It reports whether the hash was replaced.
+func (s *RedisStore) ReplacePassword(ctx context.Context, userID, oldHash, newHash string) (bool, error) {
+	return s.updateUser(ctx, userID, func(user *models.User) bool {
+		if user.Password != oldHash {
+			return false
+		}
+		user.Password = newHash
+		return true
+	})
+}
+
+// ReplaceEmail sets a user's email address to an unverified newEmail if it
+// is still oldEmail. It reports whether the address was replaced.
+func (s *RedisStore) ReplaceEmail(ctx context.Context, userID, oldEmail, newEmail string) (bool, error) {
+	return s.updateUser(ctx, userID, func(user *models.User) bool {
+		if user.Email != oldEmail {
+			return false
+		}
+		user.Email = newEmail
+		user.EmailVerified = false
+		return true
+	})
+}
+
+// MarkEmailVerified marks a user's email address verified if it is still
+// email. It reports whether the user has that address.
+func (s *RedisStore) MarkEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+	return s.updateUser(ctx, userID, func(user *models.User) bool {
+		if user.Email != email {
+			return false
+		}
+		user.EmailVerified = true
+		return true
+	})
+}
+
+// SetCanBroadcast sets whether a bot may broadcast.
+func (s *RedisStore) SetCanBroadcast(ctx context.Context, botID string, canBroadcast bool) error {
+	_, err := s.updateUser(ctx, botID, func(user *models.User) bool {
+		user.CanBroadcast = canBroadcast
+		return true
+	})
+	return err
+}
+
 func (s *RedisStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	userKey := fmt.Sprintf("%s%s", userKeyPrefix, id)
 	userData, err := s.client.Get(ctx, userKey).Bytes()
@@ -54,16 +174,12 @@ func (s *RedisStore) GetUserByID(ctx context.Context, id string) (*models.User,
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	var user models.User
-	if err := json.Unmarshal(userData, &user); err != nil {
+	user, err := unmarshalUser(userData)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
 	}
 
-	if user.Password == "" {
-		return nil, fmt.Errorf("invalid user data: missing password hash")
-	}
-
-	return &user, nil
+	return user, nil
 }
 
 func (s *RedisStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bm-197/go-chat/internal/models"
+)
+
+func TestUserPasswordStaysServerSide(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	user := models.NewUser("alice", "hash-1")
+	if err := s.SaveUser(ctx, user); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	stored, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	if stored.Password != "hash-1" {
+		t.Errorf("stored password = %q, want %q", stored.Password, "hash-1")
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if strings.Contains(string(data), "hash-1") {
+		t.Errorf("client JSON %s contains the password hash", data)
+	}
+}
+
+func TestUserUpdatesKeepOtherFields(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	user := models.NewUser("alice", "hash-1")
+	if err := s.SaveUser(ctx, user); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	if replaced, err := s.ReplaceEmail(ctx, user.ID, "", "alice@example.com"); err != nil || !replaced {
+		t.Fatalf("ReplaceEmail() = %v, %v; want true", replaced, err)
+	}
+	// A stale caller doesn't undo the change.
+	if replaced, err := s.ReplaceEmail(ctx, user.ID, "", "mallory@example.com"); err != nil || replaced {
+		t.Errorf("ReplaceEmail(stale) = %v, %v; want false", replaced, err)
+	}
+	if verified, err := s.MarkEmailVerified(ctx, user.ID, "old@example.com"); err != nil || verified {
+		t.Errorf("MarkEmailVerified(other address) = %v, %v; want false", verified, err)
+	}
+	if verified, err := s.MarkEmailVerified(ctx, user.ID, "alice@example.com"); err != nil || !verified {
+		t.Fatalf("MarkEmailVerified() = %v, %v; want true", verified, err)
+	}
+
+	if replaced, err := s.ReplacePassword(ctx, user.ID, "hash-0", "hash-2"); err != nil || replaced {
+		t.Errorf("ReplacePassword(stale) = %v, %v; want false", replaced, err)
+	}
+	if replaced, err := s.ReplacePassword(ctx, user.ID, "hash-1", "hash-2"); err != nil || !replaced {
+		t.Fatalf("ReplacePassword() = %v, %v; want true", replaced, err)
+	}
+
+	stored, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	if stored.Password != "hash-2" || stored.Email != "alice@example.com" || !stored.EmailVerified || stored.Username != "alice" {
+		t.Errorf("stored user = %+v, want the new password and the verified address", stored)
+	}
+
+	if _, err := s.ReplacePassword(ctx, "missing", "", "hash"); err == nil {
+		t.Errorf("ReplacePassword(missing user) succeeded")
+	}
+}